@@ -0,0 +1,146 @@
+package transku
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// cacheShards is how many independently locked pieces a Dictionary cache is split into.
+const cacheShards = 64
+
+// entry is a single Dictionary entry. Entries with no review state predate reviews.
+type entry struct {
+	tlate string
+	rv    Review
+}
+
+// state gives an entry's review state, counting entries without one as approved.
+func (e entry) state() ReviewState {
+	if len(e.rv.State) == 0 {
+		return ReviewApproved
+	}
+	return e.rv.State
+}
+
+// cache holds Dictionary entries split into shards by phrase, each with its own lock.
+// Every method is safe for concurrent use; a translation and its review always change together.
+type cache struct {
+	shards [cacheShards]cacheShard
+}
+
+type cacheShard struct {
+	lock    sync.RWMutex
+	entries map[string]entry
+}
+
+func newCache(tlates lookup, reviews reviewBook) *cache {
+	c := &cache{}
+	for i := range c.shards {
+		c.shards[i].entries = map[string]entry{}
+	}
+	for phrase, tlate := range tlates {
+		c.shard(phrase).entries[phrase] = entry{tlate, reviews[phrase]}
+	}
+	return c
+}
+
+func (c *cache) shard(phrase string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(phrase))
+	return &c.shards[h.Sum32()%cacheShards]
+}
+
+// get gives a phrase's entry, reporting whether it exists.
+func (c *cache) get(phrase string) (entry, bool) {
+	s := c.shard(phrase)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	e, exists := s.entries[phrase]
+	return e, exists
+}
+
+// add puts an untranslated phrase into the cache, reporting false when it was already there.
+func (c *cache) add(phrase string) bool {
+	s := c.shard(phrase)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, exists := s.entries[phrase]; exists {
+		return false
+	}
+	s.entries[phrase] = entry{}
+	return true
+}
+
+// set puts a phrase's translation and review into the cache.
+func (c *cache) set(phrase string, e entry) {
+	s := c.shard(phrase)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.entries[phrase] = e
+}
+
+// remove takes a phrase's entry out of the cache.
+func (c *cache) remove(phrase string) {
+	s := c.shard(phrase)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.entries, phrase)
+}
+
+// update changes an existing entry in place, leaving it alone if fn fails.
+func (c *cache) update(phrase string, fn func(entry) (entry, error)) (bool, error) {
+	s := c.shard(phrase)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, exists := s.entries[phrase]
+	if !exists {
+		return false, nil
+	}
+	e, err := fn(e)
+	if err != nil {
+		return true, err
+	}
+	s.entries[phrase] = e
+	return true, nil
+}
+
+// each calls fn on every entry, a shard at a time; fn must not call back into the cache.
+func (c *cache) each(fn func(phrase string, e entry)) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.lock.RLock()
+		for phrase, e := range s.entries {
+			fn(phrase, e)
+		}
+		s.lock.RUnlock()
+	}
+}
+
+// len gives how many entries the cache holds.
+func (c *cache) len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.lock.RLock()
+		n += len(s.entries)
+		s.lock.RUnlock()
+	}
+	return n
+}
+
+// snapshot copies the cache out as plain translations and reviews, as stored on AWS.
+func (c *cache) snapshot() (lookup, reviewBook) {
+	tlates, reviews := lookup{}, reviewBook{}
+	c.each(func(phrase string, e entry) {
+		tlates[phrase] = e.tlate
+		if len(e.rv.State) > 0 {
+			reviews[phrase] = e.rv
+		}
+	})
+	return tlates, reviews
+}
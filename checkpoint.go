@@ -0,0 +1,149 @@
+package transku
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stage is a pipeline step that leaves a checkpoint behind once completed.
+type Stage int
+
+const (
+	// StageNone means nothing has completed yet.
+	StageNone Stage = iota
+
+	// StageFetched means products were read from ChannelAdvisor.
+	StageFetched
+
+	// StageDictFilled means the region Dictionary was filled with translations.
+	StageDictFilled
+
+	// StageTranslated means products were translated using the Dictionary.
+	StageTranslated
+
+	// StageBuilt means international products were built.
+	StageBuilt
+
+	// StageUploaded means every chunk was uploaded to ChannelAdvisor.
+	StageUploaded
+)
+
+var stageFiles = map[Stage]string{
+	StageFetched:    "prods.gob",
+	StageDictFilled: "dict.gob",
+	StageTranslated: "translated.gob",
+	StageBuilt:      "intlprods.json",
+	StageUploaded:   "uploaded",
+}
+
+func (s Stage) String() string {
+	switch s {
+	case StageFetched:
+		return "fetched"
+	case StageDictFilled:
+		return "dictionary filled"
+	case StageTranslated:
+		return "translated"
+	case StageBuilt:
+		return "built"
+	case StageUploaded:
+		return "uploaded"
+	}
+	return "none"
+}
+
+// SetRunDir checkpoints every stage under dir; resume picks up from the last completed stage.
+func (t *TransKU) SetRunDir(dir string, resume bool) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	t.runDir = dir
+	t.resume = resume
+
+	return nil
+}
+
+// LastStage gives the last stage completed for a region in the run directory.
+func (t TransKU) LastStage(r Region) Stage {
+	last := StageNone
+	for s := StageFetched; s <= StageUploaded; s++ {
+		_, err := os.Stat(t.stagePath(r, s))
+		if err != nil {
+			break
+		}
+		last = s
+	}
+	return last
+}
+
+// runPath places a region's file in the run directory, or the working directory without one.
+func (t TransKU) runPath(r Region, name string) string {
+	tag := strings.ToLower(r.ChannelTag)
+	if len(t.runDir) == 0 {
+		return tag + "-" + name
+	}
+	return filepath.Join(t.runDir, tag, name)
+}
+
+func (t TransKU) stagePath(r Region, s Stage) string {
+	if s == StageFetched {
+		return filepath.Join(t.runDir, stageFiles[s])
+	}
+	return t.runPath(r, stageFiles[s])
+}
+
+// resumable reports whether a stage can be skipped by loading its checkpoint.
+func (t TransKU) resumable(r Region, s Stage) bool {
+	if len(t.runDir) == 0 || !t.resume {
+		return false
+	}
+	_, err := os.Stat(t.stagePath(r, s))
+	if err != nil {
+		return false
+	}
+	t.regionLogger(r).Info("resuming from checkpoint", "stage", s.String())
+	return true
+}
+
+// checkpointing reports whether completed stages should be written down.
+func (t TransKU) checkpointing() bool {
+	return len(t.runDir) > 0
+}
+
+func writeGob(fnm string, v interface{}) error {
+	err := os.MkdirAll(filepath.Dir(fnm), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fnm)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(v)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readGob(fnm string, v interface{}) error {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewDecoder(f).Decode(v)
+}
+
+func writeMarker(fnm string) error {
+	err := os.MkdirAll(filepath.Dir(fnm), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fnm, nil, 0644)
+}
@@ -0,0 +1,42 @@
+package transku
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResumeDictFilled(t *testing.T) {
+	r := Region{BCP47: "de", ChannelTag: "DE"}
+	tk := TransKU{runDir: t.TempDir(), metrics: newMetrics()}
+
+	d, err := tk.newRegionDict(r, lookup{"Red shirt": "Rotes Hemd", "Blue hat": ""}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.GoAdd(loadProds(1))
+	d.GoFillAll(strings.ToUpper)
+	fresh := d.newPhrases()
+	if fresh["Blue hat"] != "BLUE HAT" || len(fresh) < 2 {
+		t.Fatalf("new phrases %v", fresh)
+	}
+	err = tk.writeDictFilled(r, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk.resume = true
+	back, err := tk.CreateDict(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.loaded != 2 {
+		t.Fatalf("resumed Dictionary loaded %d entries, want 2", back.loaded)
+	}
+	if got := back.newPhrases(); !reflect.DeepEqual(got, fresh) {
+		t.Fatalf("resumed new phrases %v, want %v", got, fresh)
+	}
+	if back.getNewCharCnt() == 0 || back.GetPrice() != d.GetPrice() {
+		t.Fatalf("resumed price %v, want %v", back.GetPrice(), d.GetPrice())
+	}
+}
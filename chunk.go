@@ -0,0 +1,156 @@
+package transku
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Chunking splits an upload into pieces that are sent and retried on their own.
+type Chunking struct {
+	// Rows caps the number of products per chunk; zero means no cap.
+	Rows int
+
+	// Bytes caps the rough CSV size of a chunk; zero means no cap.
+	Bytes int
+
+	// Retries is how many more times a failed chunk is sent.
+	Retries int
+
+	// Backoff is the wait before the first retry, doubling after each.
+	Backoff time.Duration
+}
+
+// uploadProgress records how far an upload got so a failed run can resume.
+type uploadProgress struct {
+	Hash string `json:"hash"`
+	Sent int    `json:"sent"`
+}
+
+// split cuts layout rows (header excluded) into chunks, each led by the header.
+func (c Chunking) split(layout [][]string) [][][]string {
+	head, rows := layout[0], layout[1:]
+
+	chunks := [][][]string{}
+	chunk := [][]string{head}
+	size := rowSize(head)
+	for _, row := range rows {
+		full := len(chunk) > 1 &&
+			((c.Rows > 0 && len(chunk)-1 >= c.Rows) ||
+				(c.Bytes > 0 && size+rowSize(row) > c.Bytes))
+		if full {
+			chunks = append(chunks, chunk)
+			chunk = [][]string{head}
+			size = rowSize(head)
+		}
+		chunk = append(chunk, row)
+		size += rowSize(row)
+	}
+	if len(chunk) > 1 || len(chunks) == 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+func rowSize(row []string) int {
+	n := 0
+	for _, cell := range row {
+		n += len(cell) + 1
+	}
+	return n
+}
+
+// chunksHash fingerprints the rows and where they were cut, so a resumed upload only skips chunks cut the same way.
+func chunksHash(chunks [][][]string) string {
+	h := sha1.New()
+	for _, chunk := range chunks {
+		for _, row := range chunk {
+			h.Write([]byte(strings.Join(row, "\x1f")))
+			h.Write([]byte{'\n'})
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readProgress(fnm, hash string) uploadProgress {
+	up := uploadProgress{Hash: hash}
+
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return up
+	}
+	old := uploadProgress{}
+	if json.Unmarshal(b, &old) != nil || old.Hash != hash {
+		return up
+	}
+	return old
+}
+
+func writeProgress(fnm string, up uploadProgress) error {
+	b, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fnm), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fnm, b, 0644)
+}
+
+// sendChunks uploads the layout chunk by chunk, resuming after the last chunk sent.
+func (t TransKU) sendChunks(layout [][]string, profileID int, r Region) error {
+	log := t.regionLogger(r)
+	c := r.Chunking
+	chunks := c.split(layout)
+
+	fnm := t.runPath(r, "upload.json")
+	up := readProgress(fnm, chunksHash(chunks))
+	prog := t.tracker(r).start("upload", len(layout)-1)
+	if up.Sent > 0 {
+		log.Info("resuming upload", "chunk", up.Sent+1, "chunks", len(chunks))
+		for _, chunk := range chunks[:up.Sent] {
+			prog.add(len(chunk) - 1)
+		}
+	}
+
+	for i := up.Sent; i < len(chunks); i++ {
+		clog := log.With("chunk", i+1, "chunks", len(chunks))
+
+		done := step(clog, "writing chunk to ChannelAdvisor")
+		wait := c.Backoff
+		var err error
+		for try := 0; try <= c.Retries; try++ {
+			if try > 0 {
+				clog.Warn("retrying chunk", "wait", wait, "err", err)
+				time.Sleep(wait)
+				wait *= 2
+			}
+			err = t.ca.SendBinaryCSV(quoteLayout(chunks[i]), profileID)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			prog.end(err)
+			return err
+		}
+		done()
+		prog.add(len(chunks[i]) - 1)
+		t.metrics.Add(MetricRowsUploaded, strings.ToUpper(r.ChannelTag), float64(len(chunks[i])-1))
+
+		up.Sent = i + 1
+		err = writeProgress(fnm, up)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(fnm)
+}
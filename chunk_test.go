@@ -0,0 +1,98 @@
+package transku
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// chunkRows gives the first cell of every row after the header, chunk by chunk.
+func chunkRows(chunks [][][]string) [][]string {
+	out := [][]string{}
+	for _, chunk := range chunks {
+		rows := []string{}
+		for _, row := range chunk[1:] {
+			rows = append(rows, row[0])
+		}
+		out = append(out, rows)
+	}
+	return out
+}
+
+func TestChunkingSplit(t *testing.T) {
+	head := []string{"Inventory Number", "Title"}
+	layout := [][]string{head, {"A", "aaaa"}, {"B", "bbbb"}, {"C", "cccc"}, {"D", "dddd"}, {"E", "eeeeeeeeeeeeeeeeeeee"}}
+
+	for _, tc := range []struct {
+		name   string
+		c      Chunking
+		layout [][]string
+		want   [][]string
+	}{
+		{"no cap", Chunking{}, layout, [][]string{{"A", "B", "C", "D", "E"}}},
+		{"rows", Chunking{Rows: 2}, layout, [][]string{{"A", "B"}, {"C", "D"}, {"E"}}},
+		{"rows exact", Chunking{Rows: 5}, layout, [][]string{{"A", "B", "C", "D", "E"}}},
+		{"bytes", Chunking{Bytes: 45}, layout, [][]string{{"A", "B", "C"}, {"D"}, {"E"}}},
+		{"row over bytes", Chunking{Bytes: 1}, layout, [][]string{{"A"}, {"B"}, {"C"}, {"D"}, {"E"}}},
+		{"rows before bytes", Chunking{Rows: 2, Bytes: 45}, layout, [][]string{{"A", "B"}, {"C", "D"}, {"E"}}},
+		{"bytes before rows", Chunking{Rows: 4, Bytes: 45}, layout, [][]string{{"A", "B", "C"}, {"D"}, {"E"}}},
+		{"header only", Chunking{Rows: 2}, [][]string{head}, [][]string{{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chunks := tc.c.split(tc.layout)
+			if got := chunkRows(chunks); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("chunks %q, want %q", got, tc.want)
+			}
+			for i, chunk := range chunks {
+				if !reflect.DeepEqual(chunk[0], head) {
+					t.Fatalf("chunk %d led by %q", i+1, chunk[0])
+				}
+				if tc.c.Bytes > 0 && len(chunk) > 2 {
+					size := 0
+					for _, row := range chunk {
+						size += rowSize(row)
+					}
+					if size > tc.c.Bytes {
+						t.Fatalf("chunk %d holds %d bytes, over %d", i+1, size, tc.c.Bytes)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestChunksHash(t *testing.T) {
+	layout := [][]string{{"Inventory Number"}, {"A"}, {"B"}, {"C"}}
+
+	same := chunksHash(Chunking{Rows: 2}.split(layout))
+	if chunksHash(Chunking{Rows: 2}.split(layout)) != same {
+		t.Fatal("same chunks hashed differently")
+	}
+	if chunksHash(Chunking{Rows: 1}.split(layout)) == same {
+		t.Fatal("rows cut differently hashed the same")
+	}
+	if chunksHash(Chunking{Bytes: 1}.split(layout)) == same {
+		t.Fatal("bytes cut differently hashed the same")
+	}
+	if chunksHash(Chunking{Rows: 2}.split(layout[:3])) == same {
+		t.Fatal("different rows hashed the same")
+	}
+}
+
+func TestReadProgress(t *testing.T) {
+	fnm := filepath.Join(t.TempDir(), "run", "upload.json")
+
+	if up := readProgress(fnm, "h1"); up.Sent != 0 || up.Hash != "h1" {
+		t.Fatalf("no progress read as %+v", up)
+	}
+	err := writeProgress(fnm, uploadProgress{Hash: "h1", Sent: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if up := readProgress(fnm, "h1"); up.Sent != 2 {
+		t.Fatalf("progress read as %+v", up)
+	}
+	if up := readProgress(fnm, "h2"); up.Sent != 0 || up.Hash != "h2" {
+		t.Fatalf("progress of other chunks read as %+v", up)
+	}
+}
@@ -0,0 +1,166 @@
+// Command transku-dict serves a local web UI for browsing and editing region dictionaries,
+// and works through entries awaiting review from the command line.
+//
+//	transku-dict [flags] serve             serves the web UI (the default)
+//	transku-dict [flags] export TAG        writes a region's entries awaiting review as CSV
+//	transku-dict [flags] import TAG FILE   applies reviewed entries from CSV, saving them to AWS
+//	transku-dict [flags] blocked TAG       lists SKUs held back by entries awaiting review, whatever the region's policy
+//	transku-dict [flags] prune TAG         drops entries no product uses, such as those keyed by older versions
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	transku "github.com/WedgeNix/transKU"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve on")
+	regions := flag.String("regions", "regions.json", "JSON file of region definitions")
+	since := flag.String("since", "", "only index products created since this date (YYYY-MM-DD)")
+	out := flag.String("out", "-", "file export and blocked write to; '-' is standard output")
+	editor := flag.String("editor", "", "name recorded on imported entries")
+	flag.Parse()
+
+	rs, err := transku.LoadRegions(*regions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Time{}
+	if len(*since) > 0 {
+		start, err = time.Parse("2006-01-02", *since)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	t, err := transku.InitChapi(start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.InitAwsapi()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd := flag.Arg(0)
+	if len(cmd) == 0 {
+		cmd = "serve"
+	}
+
+	switch cmd {
+	case "serve":
+		err = t.ReadChannelAdvisor()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Fatal(t.ServeDictUI(*addr, rs))
+
+	case "export":
+		r := findRegion(rs, flag.Arg(1))
+		w, done := output(*out)
+		err = t.ExportPending(r, w)
+		if err != nil {
+			log.Fatal(err)
+		}
+		done()
+
+	case "import":
+		if len(*editor) == 0 {
+			log.Fatal("import needs -editor")
+		}
+		r := findRegion(rs, flag.Arg(1))
+		f, err := os.Open(flag.Arg(2))
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := t.ImportReviewed(r, f, *editor)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("imported", n, "reviewed entries")
+
+	case "blocked":
+		d, err := t.LoadDict(findRegion(rs, flag.Arg(1)))
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = t.ReadChannelAdvisor()
+		if err != nil {
+			log.Fatal(err)
+		}
+		w, done := output(*out)
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"SKU", "Phrases"})
+		blocked := t.BlockedSKUs(d)
+		for _, sku := range sortedSKUs(blocked) {
+			cw.Write([]string{sku, strings.Join(blocked[sku], "; ")})
+		}
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			log.Fatal(err)
+		}
+		done()
+
+	case "prune":
+		r := findRegion(rs, flag.Arg(1))
+		err = t.ReadChannelAdvisor()
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := t.PruneDict(r)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("pruned", n, "unused entries")
+
+	default:
+		log.Fatal("unknown command '" + cmd + "'; use serve, export, import, blocked or prune")
+	}
+}
+
+// findRegion finds a region by channel tag.
+func findRegion(rs []transku.Region, tag string) transku.Region {
+	for _, r := range rs {
+		if strings.EqualFold(r.ChannelTag, tag) {
+			return r
+		}
+	}
+	log.Fatal("unknown region '" + tag + "'")
+	return transku.Region{}
+}
+
+// output opens where results go, giving a func to close it.
+func output(fnm string) (io.Writer, func()) {
+	if fnm == "-" {
+		return os.Stdout, func() {}
+	}
+	f, err := os.Create(fnm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f, func() {
+		err := f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func sortedSKUs(blocked map[string][]string) []string {
+	skus := []string{}
+	for sku := range blocked {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	return skus
+}
@@ -0,0 +1,52 @@
+// Command transku-serve translates single products on demand over HTTP.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	transku "github.com/WedgeNix/transKU"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8081", "address to serve on")
+	regions := flag.String("regions", "regions.json", "JSON file of region definitions")
+	since := flag.String("since", "", "only serve catalog products created since this date (YYYY-MM-DD)")
+	catalog := flag.Bool("catalog", true, "read ChannelAdvisor products so they can be translated by SKU")
+	flag.Parse()
+
+	rs, err := transku.LoadRegions(*regions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Time{}
+	if len(*since) > 0 {
+		start, err = time.Parse("2006-01-02", *since)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	t, err := transku.InitChapi(start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.InitAwsapi()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.InitGosetta()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *catalog {
+		err = t.ReadChannelAdvisor()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Fatal(t.ServeTranslate(*addr, rs))
+}
@@ -0,0 +1,78 @@
+package transku
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// CSVFormat decides how international products are serialized.
+type CSVFormat struct {
+	// Comma is the field delimiter.
+	Comma rune
+
+	// CRLF ends lines with '\r\n' instead of '\n'.
+	CRLF bool
+
+	// BOM starts the output with a UTF-8 byte order mark.
+	BOM bool
+}
+
+var (
+	// RFC4180 is comma-separated values as laid out by RFC 4180.
+	RFC4180 = CSVFormat{Comma: ',', CRLF: true}
+
+	// ChannelAdvisorTSV is the tab-separated layout ChannelAdvisor imports.
+	ChannelAdvisorTSV = CSVFormat{Comma: '\t', CRLF: true, BOM: true}
+)
+
+const utf8BOM = "\xEF\xBB\xBF"
+
+// WriteCSV serializes the CSV layout to w, quoting fields as needed.
+func (ip IntlProds) WriteCSV(w io.Writer, cf CSVFormat) error {
+	layout, _ := ip.GetCSVLayout()
+	return writeLayout(w, layout, cf)
+}
+
+// quoteLayout quotes every cell needing it as a comma-separated CSV field would be.
+// SendBinaryCSV sends cells as they are, so the upload path quotes them first.
+func quoteLayout(layout [][]string) [][]string {
+	quoted := make([][]string, len(layout))
+	for i, row := range layout {
+		quoted[i] = make([]string, len(row))
+		for j, cell := range row {
+			quoted[i][j] = quoteCell(cell)
+		}
+	}
+	return quoted
+}
+
+func quoteCell(cell string) string {
+	b := strings.Builder{}
+	cw := csv.NewWriter(&b)
+	cw.Write([]string{cell})
+	cw.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeLayout(w io.Writer, layout [][]string, cf CSVFormat) error {
+	if cf.BOM {
+		_, err := io.WriteString(w, utf8BOM)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if cf.Comma != 0 {
+		cw.Comma = cf.Comma
+	}
+	cw.UseCRLF = cf.CRLF
+
+	err := cw.WriteAll(layout)
+	if err != nil {
+		return err
+	}
+
+	return cw.Error()
+}
@@ -0,0 +1,98 @@
+package transku
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func csvTestProds() IntlProds {
+	return IntlProds{
+		profileID: 7,
+		layout:    AttrColumns,
+		pres: []PreCSV{
+			{
+				InventoryNumber: "SKU1",
+				AuctionTitle:    `Shirt, "Slim" Fit`,
+				Description:     "<p>Soft.</p>\nMachine wash, cold.",
+				PictureURLs:     "http://a/1.jpg,http://a/2.jpg",
+				attributes:      []attrkv{{"AMZColor", "Red, \"crimson\""}},
+			},
+			{
+				InventoryNumber: "SKU2",
+				AuctionTitle:    "Plain",
+				Description:     "line one\r\nline two",
+				PictureURLs:     "http://a/3.jpg",
+			},
+		},
+	}
+}
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	ip := csvTestProds()
+	want, _ := ip.GetCSVLayout()
+
+	for _, tc := range []struct {
+		name string
+		cf   CSVFormat
+	}{
+		{"rfc4180", RFC4180},
+		{"channeladvisor", ChannelAdvisorTSV},
+		{"semicolon", CSVFormat{Comma: ';'}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := bytes.Buffer{}
+			err := ip.WriteCSV(&buf, tc.cf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := buf.String()
+			if strings.HasPrefix(out, utf8BOM) != tc.cf.BOM {
+				t.Fatalf("BOM present = %v, want %v", !tc.cf.BOM, tc.cf.BOM)
+			}
+			out = strings.TrimPrefix(out, utf8BOM)
+
+			cr := csv.NewReader(strings.NewReader(out))
+			cr.Comma = tc.cf.Comma
+			if cr.Comma == 0 {
+				cr.Comma = ','
+			}
+			got, err := cr.ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// csv.Reader folds '\r\n' inside quoted fields to '\n'
+			for _, row := range want {
+				for i := range row {
+					row[i] = strings.ReplaceAll(row[i], "\r\n", "\n")
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip mismatch\n got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+func TestQuoteLayout(t *testing.T) {
+	layout, _ := csvTestProds().GetCSVLayout()
+	quoted := quoteLayout(layout)
+
+	for i, row := range quoted {
+		line := strings.Join(row, ",")
+		got, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		want := append([]string{}, layout[i]...)
+		for j := range want {
+			want[j] = strings.ReplaceAll(want[j], "\r\n", "\n")
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("row %d\n got %q\nwant %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package transku
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// uploadRecord maps every uploaded inventory number to the hash of its last sent row.
+type uploadRecord map[string]string
+
+// hash fingerprints everything about a row that ends up in ChannelAdvisor.
+func (pre PreCSV) hash() string {
+	attrs := []string{}
+	for _, attr := range pre.attributes {
+		attrs = append(attrs, attr.name+"\x1f"+attr.value)
+	}
+	sort.Strings(attrs)
+
+	h := sha1.New()
+	for _, field := range []string{
+		pre.InventoryNumber,
+		pre.AuctionTitle,
+		pre.Brand,
+		pre.BuyItNowPrice,
+		pre.Classification,
+		pre.Description,
+		pre.Labels,
+		pre.PictureURLs,
+		pre.RelationshipName,
+		pre.RetailPrice,
+		pre.SellerCost,
+		pre.UPC,
+		pre.VariationParentSKU,
+		pre.Weight,
+		strings.Join(attrs, "\x1e"),
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// delta gives only the new or changed rows plus the record to keep once they are sent.
+// Inventory numbers gone from catalog are re-sent labelled deactivate, when set.
+func (rec uploadRecord) delta(ip IntlProds, deactivate string, catalog map[string]bool) (IntlProds, uploadRecord) {
+	next := uploadRecord{}
+	send := rec.changed(ip, next)
+	send.pres = append(send.pres, rec.vanished(next, deactivate, catalog)...)
+
+	return send, next
+}
+
+// changed gives only the new or changed rows, noting every row's hash in next.
+func (rec uploadRecord) changed(ip IntlProds, next uploadRecord) IntlProds {
+	send := ip
+	send.pres = nil
+
+	for _, pre := range ip.pres {
+		h := pre.hash()
+		next[pre.InventoryNumber] = h
+		if rec[pre.InventoryNumber] == h {
+			continue
+		}
+		send.pres = append(send.pres, pre)
+	}
+
+	return send
+}
+
+// vanished gives rows labelled deactivate for inventory numbers missing from both next and catalog.
+// Products read but not built, such as held, skipped or dropped ones, are still live, so their old hashes
+// are carried over into next instead; so is everything without deactivate or without a whole catalog.
+func (rec uploadRecord) vanished(next uploadRecord, deactivate string, catalog map[string]bool) []PreCSV {
+	gone := []string{}
+	for sku, h := range rec {
+		if _, exists := next[sku]; exists {
+			continue
+		}
+		if len(deactivate) == 0 || catalog == nil || catalog[sku] {
+			next[sku] = h
+			continue
+		}
+		gone = append(gone, sku)
+	}
+	sort.Strings(gone)
+
+	pres := []PreCSV{}
+	for _, sku := range gone {
+		pres = append(pres, PreCSV{InventoryNumber: sku, Labels: deactivate})
+	}
+	return pres
+}
+
+// catalogSKUs gives every SKU read from ChannelAdvisor, or nil when the read was not the whole catalog,
+// as with a createDate window or an upload from file, leaving no way to tell a product is gone.
+func (t TransKU) catalogSKUs(r Region) map[string]bool {
+	if len(r.DeactivateLabel) == 0 {
+		return nil
+	}
+	if !t.createDate.IsZero() || len(t.prods) == 0 {
+		t.regionLogger(r).Warn("catalog not read whole; keeping vanished SKUs active", "since", t.createDate)
+		return nil
+	}
+
+	catalog := map[string]bool{}
+	for _, prod := range t.prods {
+		catalog[prod.Sku] = true
+	}
+	return catalog
+}
+
+func uploadRecordName(r Region) string {
+	return "transku/" + strings.ToLower(r.ChannelTag+"-uploads.gob")
+}
+
+// readUploadRecord reads the region's last upload record, starting fresh if there is none.
+func (t TransKU) readUploadRecord(r Region) uploadRecord {
+	log := t.regionLogger(r)
+	rec := uploadRecord{}
+
+	done := step(log, "reading upload record from AWS")
+	err := t.aws.Read(uploadRecordName(r), &rec)
+	if err != nil {
+		log.Warn("no upload record found; sending every row", "err", err)
+		return uploadRecord{}
+	}
+	done()
+
+	return rec
+}
+
+// writeUploadRecord keeps the region's upload record for the next run.
+func (t TransKU) writeUploadRecord(r Region, rec uploadRecord) error {
+	done := step(t.regionLogger(r), "writing upload record to AWS")
+	err := t.aws.Write(uploadRecordName(r), rec)
+	if err != nil {
+		return err
+	}
+	done()
+
+	return nil
+}
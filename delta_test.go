@@ -0,0 +1,134 @@
+package transku
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/WedgeNix/chapi"
+)
+
+func deltaPres(skus ...string) IntlProds {
+	ip := IntlProds{profileID: 7}
+	for _, sku := range skus {
+		ip.pres = append(ip.pres, PreCSV{InventoryNumber: sku, AuctionTitle: "Hemd " + sku})
+	}
+	return ip
+}
+
+func presSKUs(pres []PreCSV) []string {
+	skus := []string{}
+	for _, pre := range pres {
+		skus = append(skus, pre.InventoryNumber+"|"+pre.Labels)
+	}
+	return skus
+}
+
+func recordSKUs(rec uploadRecord) []string {
+	skus := []string{}
+	for sku := range rec {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+	return skus
+}
+
+func TestChanged(t *testing.T) {
+	old := deltaPres("A", "B", "C")
+	rec := uploadRecord{}
+	for _, pre := range old.pres {
+		rec[pre.InventoryNumber] = pre.hash()
+	}
+
+	ip := deltaPres("A", "B", "D")
+	ip.pres[1].AuctionTitle = "Neues Hemd"
+	next := uploadRecord{}
+	send := rec.changed(ip, next)
+
+	if got, want := presSKUs(send.pres), []string{"B|", "D|"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	if send.profileID != 7 {
+		t.Fatalf("profile ID %d lost", send.profileID)
+	}
+	if got, want := recordSKUs(next), []string{"A", "B", "D"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("next record %q, want %q", got, want)
+	}
+	if next["B"] != ip.pres[1].hash() {
+		t.Fatal("next record keeps the old hash of a changed row")
+	}
+}
+
+func TestVanished(t *testing.T) {
+	rec := uploadRecord{"A": "a", "B": "b", "C": "c"}
+
+	for _, tc := range []struct {
+		name       string
+		deactivate string
+		catalog    map[string]bool
+		gone       []string
+		next       []string
+	}{
+		{"no label", "", map[string]bool{"A": true}, []string{}, []string{"A", "B", "C"}},
+		{"partial catalog", "Inactive", nil, []string{}, []string{"A", "B", "C"}},
+		{"held or skipped", "Inactive", map[string]bool{"A": true, "B": true, "C": true}, []string{}, []string{"A", "B", "C"}},
+		{"gone", "Inactive", map[string]bool{"A": true, "B": true}, []string{"C|Inactive"}, []string{"A", "B"}},
+		{"all gone", "Inactive", map[string]bool{"A": true}, []string{"B|Inactive", "C|Inactive"}, []string{"A"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// only A was built this run
+			next := uploadRecord{"A": "a2"}
+			gone := rec.vanished(next, tc.deactivate, tc.catalog)
+
+			if got := presSKUs(gone); !reflect.DeepEqual(got, tc.gone) {
+				t.Fatalf("deactivated %q, want %q", got, tc.gone)
+			}
+			if got := recordSKUs(next); !reflect.DeepEqual(got, tc.next) {
+				t.Fatalf("next record %q, want %q", got, tc.next)
+			}
+			if next["A"] != "a2" {
+				t.Fatal("built row's hash overwritten")
+			}
+			for _, sku := range tc.next[1:] {
+				if next[sku] != rec[sku] {
+					t.Fatalf("'%s' kept hash '%s', want '%s'", sku, next[sku], rec[sku])
+				}
+			}
+		})
+	}
+}
+
+func TestDelta(t *testing.T) {
+	built := deltaPres("A", "B")
+	_, rec := uploadRecord{}.delta(built, "", nil)
+
+	// B is held this run, C was never read again
+	rec["C"] = "c"
+	send, next := rec.delta(deltaPres("A"), "Inactive", map[string]bool{"A": true, "B": true})
+
+	if got, want := presSKUs(send.pres), []string{"C|Inactive"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	if next["B"] != built.pres[1].hash() {
+		t.Fatal("held row's hash not carried over")
+	}
+	if _, exists := next["C"]; exists {
+		t.Fatal("deactivated row kept in the record")
+	}
+}
+
+func TestCatalogSKUs(t *testing.T) {
+	r := Region{ChannelTag: "DE", DeactivateLabel: "Inactive"}
+	prods := []chapi.Product{{Sku: "A"}, {Sku: "B"}}
+
+	if got := (TransKU{prods: prods}).catalogSKUs(r); !reflect.DeepEqual(got, map[string]bool{"A": true, "B": true}) {
+		t.Fatalf("whole catalog gave %v", got)
+	}
+	if got := (TransKU{prods: prods, createDate: time.Now()}).catalogSKUs(r); got != nil {
+		t.Fatalf("windowed catalog gave %v", got)
+	}
+	if got := (TransKU{}).catalogSKUs(r); got != nil {
+		t.Fatalf("unread catalog gave %v", got)
+	}
+}
@@ -1,32 +1,41 @@
 package transku
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/text/currency"
 	"golang.org/x/text/language"
 
 	"github.com/WedgeNix/chapi"
-	"github.com/WedgeNix/util"
 )
 
-func newDictionary(lang language.Tag, cache ...lookup) *Dictionary {
-	dict := &Dictionary{cache: lookup{}, lang: lang}
-	if len(cache) > 0 {
-		dict.cache = cache[0]
-		dict.cacheCharCnt = dict.getCharCnt()
+func newDictionary(lang language.Tag, attrs AttrPolicies, tlates lookup, reviews reviewBook) *Dictionary {
+	dict := &Dictionary{
+		cache:    newCache(tlates, reviews),
+		lang:     lang,
+		attrs:    attrs,
+		trk:      newTracker(logger, nil, ""),
+		quality:  DefaultQualityCheck,
+		fresh:    lookup{},
+		inflight: map[string]chan struct{}{},
 	}
+	dict.cacheCharCnt = dict.getCharCnt()
+	dict.loaded = len(tlates)
 	return dict
 }
 
 func (dict *Dictionary) String() string {
-	dict.jobs.Wait()
-	return fmt.Sprintln(dict.cache)
+	tlates, _ := dict.cache.snapshot()
+	return fmt.Sprintln(tlates)
 }
 
 var (
-	// FilterAttr is a mapping of to-translate attributes.
+	// FilterAttr is a mapping of to-translate attributes, used when a Region has no Attrs.
 	FilterAttr = map[string]bool{
 		`AMZ_Category`:           false,
 		`AMZ_Color_Map`:          false,
@@ -79,7 +88,8 @@ var (
 	}
 )
 
-func (dict *Dictionary) filter(p *chapi.Product) ([]*string, int) {
+// filter gives pointers to every product field going through the Dictionary, with their names and which of them are titles.
+func (dict *Dictionary) filter(p *chapi.Product) ([]*string, []string, map[int]bool) {
 	fill := []*string{
 	// &p.Title,
 	// &p.Sku,
@@ -99,167 +109,259 @@ func (dict *Dictionary) filter(p *chapi.Product) ([]*string, int) {
 	// &p.Labels,
 	// &p.Classification,
 	}
-	titleIdx := -1
+	names := []string{}
+	titles := map[int]bool{}
+	for _, f := range dict.attrs.Fields {
+		switch f {
+		case FieldTitle:
+			titles[len(fill)] = true
+			fill = append(fill, &p.Title)
+		case FieldDescription:
+			fill = append(fill, &p.Description)
+		case FieldClassification:
+			fill = append(fill, &p.Classification)
+		default:
+			continue
+		}
+		names = append(names, string(f))
+	}
 	for i := range p.Attributes {
-		if FilterAttr[p.Attributes[i].Name] {
+		if dict.attrs.translates(p.Attributes[i].Name) {
 			if p.Attributes[i].Name == `AMZTitle` {
-				titleIdx = i
+				titles[len(fill)] = true
 			}
 			fill = append(fill, &p.Attributes[i].Value)
+			names = append(names, p.Attributes[i].Name)
 		}
 	}
-	return fill, titleIdx
+	return fill, names, titles
 }
 
-// GoAdd adds specific product fields into the Dictionary (concurrently).
+// GoAdd adds specific product fields into the Dictionary (concurrently), returning once they are all in.
 func (dict *Dictionary) GoAdd(prods []chapi.Product) {
-	dict.jobs.Add(len(prods))
+	var jobs sync.WaitGroup
+	prog := dict.trk.start("add phrases", len(prods))
+	jobs.Add(len(prods))
 
 	for _, prod := range prods {
 		// if !prod.IsParent {
-		// 	dict.jobs.Done()
+		// 	jobs.Done()
 		// 	continue
 		// }
 		go func(prod chapi.Product) {
-			defer dict.jobs.Done()
+			defer jobs.Done()
 
-			fields, titleIdx := dict.filter(&prod)
+			fields, _, titles := dict.filter(&prod)
 
 			for i := range fields {
-				head, tail := getChildTitleSize(prod, fields, i, titleIdx)
+				head, tail := getChildTitleSize(prod, fields, i, titles)
 				if len(tail) > 0 {
 					dict.stripAndAddText(tail, prod)
 				}
 				dict.stripAndAddText(head, prod)
 			}
+			prog.add(1)
 		}(prod)
 	}
+	jobs.Wait()
 }
 
-func getChildTitleSize(prod chapi.Product, fields []*string, i, titleIdx int) (string, string) {
+func getChildTitleSize(prod chapi.Product, fields []*string, i int, titles map[int]bool) (string, string) {
 	text := *fields[i]
-	if i != titleIdx || prod.IsParent {
+	if !titles[i] || prod.IsParent {
 		return text, ""
 	}
 	sizeIdx := strings.LastIndex(text, "-")
 	if sizeIdx == -1 || len(text)-1 < sizeIdx+1 {
 		return text, ""
 	}
-	util.Log("[Found child size in title]")
+	logger.Debug("found child size in title", "sku", prod.Sku)
 	return text[:sizeIdx], text[sizeIdx+1:]
 }
 
-func strip(text string, prod chapi.Product, onlyPhrases bool) (tags, brands, phrases bag, toks string) {
-	noTags := htmlRegex.ReplaceAllString(text, "<>")
-	noTagsAndBrand := strings.Replace(noTags, prod.Brand, "[]", -1)
-
-	if !onlyPhrases { // efficiency
-		tags = bag{items: htmlRegex.FindAllString(text, -1), tok: "<>"}
-		brandCnt := strings.Count(noTags, prod.Brand)
-		brndz := []string{}
-		brandRng := make([]int, brandCnt)
-		for range brandRng {
-			brndz = append(brndz, prod.Brand)
+// strip masks a product field, holding its brand out of every segment.
+func strip(text string, prod chapi.Product) masked {
+	return mask(text, prod.Brand)
+}
+
+// productPhrases gives every distinct phrase a product sends through the Dictionary.
+func (dict *Dictionary) productPhrases(prod chapi.Product) []string {
+	seen := map[string]bool{}
+	phrases := []string{}
+	fields, _, titles := dict.filter(&prod)
+	for i := range fields {
+		head, tail := getChildTitleSize(prod, fields, i, titles)
+		for _, text := range []string{head, tail} {
+			for _, seg := range strip(text, prod).segs {
+				if seen[seg.text] {
+					continue
+				}
+				seen[seg.text] = true
+				phrases = append(phrases, seg.text)
+			}
 		}
-		brands = bag{items: brndz, tok: "[]"}
-		toks = phraseRegex.ReplaceAllString(noTagsAndBrand, "{}")
 	}
+	return phrases
+}
 
-	phrases = bag{items: phraseRegex.FindAllString(noTagsAndBrand, -1), tok: "{}", tlate: true}
-	return
+// unused gives the sorted phrases of every entry none of the products use.
+func (dict *Dictionary) unused(prods []chapi.Product) []string {
+	used := map[string]bool{}
+	for _, prod := range prods {
+		for _, phrase := range dict.productPhrases(prod) {
+			used[phrase] = true
+		}
+	}
+
+	unused := []string{}
+	dict.cache.each(func(phrase string, _ entry) {
+		if !used[phrase] {
+			unused = append(unused, phrase)
+		}
+	})
+	sort.Strings(unused)
+	return unused
 }
 
 func (dict *Dictionary) stripAndAddText(text string, prod chapi.Product) {
-	_, _, phrases, _ := strip(text, prod, true)
+	m := strip(text, prod)
+
+	hits := 0
+	defer func() {
+		dict.metrics.Add(MetricPhrasesExtracted, dict.trk.region, float64(len(m.segs)))
+		dict.metrics.Add(MetricCacheHits, dict.trk.region, float64(hits))
+		dict.metrics.Add(MetricCacheMisses, dict.trk.region, float64(len(m.segs)-hits))
+	}()
 
 	// if text == `MyPakage Men's Weekday Boxer Brief Underwear-Small` {
 	// 	println(`stripAndAddText(`, text, `, ...)`)
 	// }
 
-	for _, phrase := range phrases.items {
+	for _, seg := range m.segs {
+		phrase := seg.text
 		// if phrase == `Men's Weekday Boxer Brief Underwear-Small` {
 		// 	println(`stripAndAddText:`, phrase)
 		// }
 
-		dict.lock.RLock()
-		_, exists := dict.cache[phrase]
-		dict.lock.RUnlock()
-
-		if exists {
-			continue
+		if !dict.cache.add(phrase) {
+			hits++
 		}
-
-		dict.lock.Lock()
-		dict.cache[phrase] = ""
-		dict.lock.Unlock()
 	}
 }
 
-// GoFillAll sets every entry in the Dictionary using the passed-in function (concurrently).
+// GoFillAll sets every untranslated entry in the Dictionary using the passed-in function (concurrently).
+// Phrases another call is already translating are waited on rather than translated twice.
 func (dict *Dictionary) GoFillAll(cacheMiss func(string) string) {
-	dict.jobs.Wait()
+	var jobs sync.WaitGroup
 
-	newEntries := make(chan lookup, 1)
-	newEntries <- lookup{}
+	dict.lock.Lock()
+	dict.translate = cacheMiss
+	dict.lock.Unlock()
 
-	fmt.Println(`len(dict.cache)=`, len(dict.cache))
-	for word, tlate := range dict.cache {
-		if len(tlate) > 0 {
-			// fmt.Print(`O`)
-			continue
+	words := []string{}
+	dict.cache.each(func(word string, e entry) {
+		if len(e.tlate) == 0 {
+			words = append(words, word)
 		}
+	})
+	dict.trk.log.Info("filling Dictionary", "entries", dict.cache.len(), "misses", len(words))
+	prog := dict.trk.start("translate phrases", len(words))
 
+	for _, word := range words {
 		word := word
 
-		dict.jobs.Add(1)
+		jobs.Add(1)
 		go func() {
-			defer dict.jobs.Done()
-			// fmt.Print(`X`)
-
-			tlate := word
-			if dict.lang != language.English {
-				tlate = cacheMiss(word)
-			}
-			// fmt.Print(word + `>>` + tlate)
-
-			e := <-newEntries
-			e[word] = tlate
-			newEntries <- e
+			defer jobs.Done()
+			dict.translateOnce(word, cacheMiss)
+			prog.add(1)
 		}()
 	}
-	dict.jobs.Wait()
+	jobs.Wait()
+}
+
+// translateOnce machine translates a phrase still lacking a translation, giving its entry.
+// Callers translating the same phrase at once wait on the first, so it is only ever translated (and paid for) once.
+func (dict *Dictionary) translateOnce(word string, cacheMiss func(string) string) entry {
+	for {
+		dict.lock.Lock()
+		busy, claimed := dict.inflight[word]
+		if !claimed {
+			dict.inflight[word] = make(chan struct{})
+		}
+		dict.lock.Unlock()
+		if !claimed {
+			break
+		}
+		<-busy
+	}
+	defer func() {
+		dict.lock.Lock()
+		close(dict.inflight[word])
+		delete(dict.inflight, word)
+		dict.lock.Unlock()
+	}()
 
-	for word, tlate := range <-newEntries {
-		dict.cache[word] = tlate
+	if e, found := dict.cache.get(word); found && len(e.tlate) > 0 {
+		return e
 	}
+
+	tlate, rv := dict.machineTranslate(word, cacheMiss)
+	e := entry{tlate, rv}
+	dict.cache.set(word, e)
+
+	dict.lock.Lock()
+	dict.fresh[word] = tlate
+	dict.lock.Unlock()
+
+	return e
 }
 
-func (dict *Dictionary) swapNShift(toks string, b bag) string {
-	for _, itm := range b.items {
-		if b.tlate {
-			dict.lock.RLock()
-			tlate, found := dict.cache[itm]
-			if !found {
-				panic("did not find `" + itm + "` in dictionary")
-			}
-			dict.lock.RUnlock()
-			itm = tlate
+// unmask puts masked text back together with each segment translated.
+// Segments missing from the Dictionary, or translated to nothing, go through miss.
+// Segments without a usable translation, or whose translation lost its placeholders, stay in English.
+func (dict *Dictionary) unmask(m masked, miss func(seg segment, empty bool) string) string {
+	return m.join(func(seg segment) string {
+		e, found := dict.cache.get(seg.text)
+		tlate, use := e.tlate, dict.usable(e)
+
+		switch {
+		case !found || (use && len(tlate) == 0):
+			tlate = miss(seg, found)
+		case !use:
+			tlate = seg.text
 		}
-		toks = strings.Replace(toks, b.tok, itm, 1)
-	}
-	return toks
+
+		out, err := seg.restore(tlate)
+		if err != nil {
+			dict.trk.log.Warn("keeping English for segment", "segment", seg.text, "err", err)
+			out, _ = seg.restore(seg.text)
+		}
+		return out
+	})
 }
 
 // GoTransAll combs through products and fills up a new version with specifics translated.
-func (dict *Dictionary) GoTransAll(prods []chapi.Product) []chapi.Product {
-	dict.jobs.Wait()
+// Products held for review under HoldProduct are left out along with their variation family.
+// Segments missing from the Dictionary are handled by the region's MissingPolicy,
+// with SkipProduct leaving out the whole variation family too.
+// Both are given back in the TransResult, even when the region fails.
+func (dict *Dictionary) GoTransAll(prods []chapi.Product) ([]chapi.Product, TransResult, error) {
+	var jobs sync.WaitGroup
 
 	newProds := make([]chapi.Product, len(prods))
+	skip := make([]bool, len(prods))
+	prog := dict.trk.start("translate products", len(prods))
+
+	blocked := map[string][]string{}
+	skipped := map[string]bool{}
+	missed := []MissingEntry{}
+	var lock sync.Mutex
 
-	dict.jobs.Add(len(prods))
+	jobs.Add(len(prods))
 	for i, prod := range prods {
 		go func(i int, prod chapi.Product) {
-			defer dict.jobs.Done()
+			defer jobs.Done()
 
 			var attrs []chapi.AttributeValue
 			for _, attr := range prod.Attributes {
@@ -267,7 +369,9 @@ func (dict *Dictionary) GoTransAll(prods []chapi.Product) []chapi.Product {
 			}
 			prod.Attributes = attrs
 
-			fields, titleIdx := dict.filter(&prod)
+			fields, names, titles := dict.filter(&prod)
+			held := []string{}
+			misses := []MissingEntry{}
 
 			for i, field := range fields {
 				// is := *field == `MyPakage Men's Weekday Boxer Brief Underwear-Small`
@@ -276,19 +380,21 @@ func (dict *Dictionary) GoTransAll(prods []chapi.Product) []chapi.Product {
 				// 	println(`ORIGINAL:`, *field)
 				// }
 
-				head, tail := getChildTitleSize(prod, fields, i, titleIdx)
+				miss := func(seg segment, empty bool) string {
+					misses = append(misses, MissingEntry{prod.Sku, names[i], seg.text, empty})
+					return dict.fillMissing(seg)
+				}
+
+				head, tail := getChildTitleSize(prod, fields, i, titles)
 
-				tags, brands, phrases, toks := strip(head, prod, false)
-				toks = dict.swapNShift(toks, tags)
-				toks = dict.swapNShift(toks, brands)
-				toks = dict.swapNShift(toks, phrases)
+				m := strip(head, prod)
+				held = append(held, dict.blockedBy(m)...)
+				toks := dict.unmask(m, miss)
 
 				if len(tail) > 0 {
-					tags, brands, phrases, tailtoks := strip(tail, prod, false)
-					tailtoks = dict.swapNShift(tailtoks, tags)
-					tailtoks = dict.swapNShift(tailtoks, brands)
-					tailtoks = dict.swapNShift(tailtoks, phrases)
-					toks += "-" + tailtoks
+					m := strip(tail, prod)
+					held = append(held, dict.blockedBy(m)...)
+					toks += "-" + dict.unmask(m, miss)
 				}
 
 				// if is {
@@ -298,12 +404,53 @@ func (dict *Dictionary) GoTransAll(prods []chapi.Product) []chapi.Product {
 				*field = toks
 			}
 
+			lock.Lock()
+			if len(misses) > 0 {
+				if dict.missing == SkipProduct {
+					skipped[prod.Sku] = true
+				}
+				missed = append(missed, misses...)
+			}
+			if len(held) > 0 {
+				skip[i] = true
+				blocked[prod.Sku] = held
+			}
+			lock.Unlock()
+
 			newProds[i] = prod
+			prog.add(1)
 		}(i, prod)
 	}
-	dict.jobs.Wait()
+	jobs.Wait()
+
+	holdFamilies(prods, blocked)
+	skipFamilies(prods, skipped)
+	for i, prod := range prods {
+		if _, held := blocked[prod.Sku]; held || skipped[prod.Sku] {
+			skip[i] = true
+		}
+	}
+
+	res := TransResult{Blocked: blocked, Missing: missed, Skipped: sortedKeys(skipped)}
 
-	return newProds
+	if len(missed) > 0 {
+		dict.trk.log.Warn("segments missing from Dictionary", "entries", len(missed), "policy", int(dict.missing))
+		if dict.missing == FailRegion {
+			return nil, res, errors.New(strconv.Itoa(len(missed)) + " segments missing from Dictionary")
+		}
+	}
+
+	kept := newProds[:0]
+	for i, prod := range newProds {
+		if !skip[i] {
+			kept = append(kept, prod)
+		}
+	}
+	if len(kept) < len(prods) {
+		dict.trk.log.Warn("products held back", "held", len(prods)-len(kept))
+	}
+
+	return kept, res, nil
 }
 
 // SHOULD CORRECT FOR DIFFERENCE BETWEEN LOADED CACHE AND NEW ENTRIES.
@@ -320,13 +467,11 @@ func (dict *Dictionary) GetPrice() currency.Amount {
 }
 
 func (dict *Dictionary) getCharCnt() int {
-	dict.jobs.Wait()
-
 	charCnt := 0
 
-	for word := range dict.cache {
+	dict.cache.each(func(word string, _ entry) {
 		charCnt += len(word)
-	}
+	})
 
 	return charCnt
 }
@@ -0,0 +1,209 @@
+package transku
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/text/language"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// loadProds builds n products, every one with phrases of its own and phrases shared by all.
+func loadProds(n int) []chapi.Product {
+	prods := []chapi.Product{}
+	for i := 0; i < n; i++ {
+		sku := "SKU" + strconv.Itoa(i)
+		prods = append(prods, chapi.Product{
+			ID:    i + 1,
+			Sku:   sku,
+			Brand: "Acme",
+			Attributes: []chapi.AttributeValue{
+				{Name: "AMZColor", Value: "Crimson red"},
+				{Name: "AMZTitle", Value: "Acme shirt number " + strconv.Itoa(i%7) + " in cotton"},
+				{Name: "AMZDescription", Value: "Soft shirt for product " + sku + ". Machine wash cold."},
+			},
+		})
+	}
+	return prods
+}
+
+// countingTranslator counts how often every phrase is translated.
+type countingTranslator struct {
+	lock  sync.Mutex
+	calls map[string]int
+}
+
+func (ct *countingTranslator) translate(s string) string {
+	ct.lock.Lock()
+	ct.calls[s]++
+	ct.lock.Unlock()
+	return "übersetzt " + s
+}
+
+// TestDictionaryConcurrentLoad runs every Dictionary method at once; run it with -race.
+func TestDictionaryConcurrentLoad(t *testing.T) {
+	const workers = 8
+	prods := loadProds(200)
+	ct := &countingTranslator{calls: map[string]int{}}
+
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{}, reviewBook{})
+	d.missing = TranslateMissing
+
+	work := sync.WaitGroup{}
+	results := make([]TransResult, workers)
+	for w := 0; w < workers; w++ {
+		work.Add(1)
+		go func(w int) {
+			defer work.Done()
+
+			// every worker adds and fills the same products, racing on the same phrases
+			d.GoAdd(prods)
+			d.GoFillAll(ct.translate)
+
+			// each worker translates its own slice and must only see its own results
+			mine := prods[w*len(prods)/workers : (w+1)*len(prods)/workers]
+			out, res, err := d.GoTransAll(mine)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(out) != len(mine) {
+				t.Errorf("worker %d: kept %d of %d products", w, len(out), len(mine))
+			}
+			results[w] = res
+
+			d.SetEntry("Crimson red", "Purpurrot", ReviewApproved, "worker"+strconv.Itoa(w))
+			d.Quarantine()
+			d.cache.snapshot()
+			d.entries(func(dictEntry) bool { return true })
+			d.newPhrases()
+			d.GetPrice()
+		}(w)
+	}
+	work.Wait()
+
+	for phrase, n := range ct.calls {
+		if n != 1 {
+			t.Errorf("'%s' translated %d times", phrase, n)
+		}
+	}
+	if len(ct.calls) != d.cache.len() {
+		t.Errorf("translated %d phrases, Dictionary holds %d", len(ct.calls), d.cache.len())
+	}
+	for w, res := range results {
+		if len(res.Missing) > 0 || len(res.Blocked) > 0 {
+			t.Errorf("worker %d: unexpected result %+v", w, res)
+		}
+	}
+}
+
+// TestTranslateMissingOnce checks concurrent misses of one phrase are translated once and reported per call.
+func TestTranslateMissingOnce(t *testing.T) {
+	const workers = 16
+	prods := loadProds(1)
+	ct := &countingTranslator{calls: map[string]int{}}
+
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{}, reviewBook{})
+	d.missing = TranslateMissing
+	d.translate = ct.translate
+
+	work := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		work.Add(1)
+		go func() {
+			defer work.Done()
+			out, res, err := d.GoTransAll(prods)
+			if err != nil || len(out) != 1 {
+				t.Errorf("kept %d products: %v", len(out), err)
+			}
+			for _, me := range res.Missing {
+				if me.SKU != prods[0].Sku {
+					t.Errorf("missing entry for another call's SKU '%s'", me.SKU)
+				}
+			}
+		}()
+	}
+	work.Wait()
+
+	for phrase, n := range ct.calls {
+		if n != 1 {
+			t.Errorf("'%s' translated %d times", phrase, n)
+		}
+	}
+}
+
+// TestSkipProductFamily checks SkipProduct leaves out the whole variation family of a product with a missing segment.
+func TestSkipProductFamily(t *testing.T) {
+	color := func(id, parent int, isParent bool, sku, value string) chapi.Product {
+		return chapi.Product{
+			ID:              id,
+			ParentProductID: parent,
+			IsParent:        isParent,
+			Sku:             sku,
+			Attributes:      []chapi.AttributeValue{{Name: "AMZColor", Value: value}},
+		}
+	}
+	prods := []chapi.Product{
+		color(1, 0, true, "P", "Red"),
+		color(2, 1, false, "C1", "Green"),
+		color(3, 1, false, "C2", "Red"),
+		color(4, 0, false, "S", "Red"),
+	}
+
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{"Red": "Rot"}, reviewBook{})
+	d.missing = SkipProduct
+
+	out, res, err := d.GoTransAll(prods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Sku != "S" {
+		t.Fatalf("kept %v, want only S", out)
+	}
+	if want := []string{"C1", "C2", "P"}; !reflect.DeepEqual(res.Skipped, want) {
+		t.Fatalf("skipped %q, want %q", res.Skipped, want)
+	}
+	if len(res.Missing) != 1 || res.Missing[0].SKU != "C1" {
+		t.Fatalf("missing %+v, want only C1's segment", res.Missing)
+	}
+}
+
+// TestRefilledEntryIsFresh checks an empty entry filled under TranslateMissing counts as new, though the Dictionary does not grow.
+func TestRefilledEntryIsFresh(t *testing.T) {
+	prods := []chapi.Product{{Sku: "A", Attributes: []chapi.AttributeValue{{Name: "AMZColor", Value: "Red"}}}}
+
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{"Red": ""}, reviewBook{})
+	d.missing = TranslateMissing
+	d.translate = func(string) string { return "Rot" }
+
+	entries, fresh := d.cache.len(), d.freshLen()
+	out, _, err := d.GoTransAll(prods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0].Attributes[0].Value != "Rot" {
+		t.Fatalf("translated to '%s'", out[0].Attributes[0].Value)
+	}
+	if d.cache.len() != entries || d.freshLen() != fresh+1 {
+		t.Fatalf("%d entries and %d new, want %d and %d", d.cache.len(), d.freshLen(), entries, fresh+1)
+	}
+}
+
+// TestUnused checks entries keyed by old word phrases are found unused once the catalog is segmented.
+func TestUnused(t *testing.T) {
+	prods := []chapi.Product{{Sku: "A", Attributes: []chapi.AttributeValue{{Name: "AMZColor", Value: "Crimson red, 2 pack"}}}}
+
+	// 'Crimson red' and 'pack' are how the phrase regex once cut the attribute
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{"Crimson red": "Purpurrot", "pack": "Packung"}, reviewBook{})
+	d.GoAdd(prods)
+
+	if got, want := d.unused(prods), []string{"Crimson red", "pack"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unused %q, want %q", got, want)
+	}
+	if got := d.unused(prods[:0]); len(got) != 3 {
+		t.Fatalf("without products %d unused, want 3", len(got))
+	}
+}
@@ -0,0 +1,217 @@
+package transku
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// dictFile is a Dictionary as checkpointed, reviews included.
+// Loaded, LoadedChars and Fresh keep what the Dictionary read from AWS held, so a resumed run reports against that.
+type dictFile struct {
+	Cache       lookup
+	Reviews     reviewBook
+	Loaded      int
+	LoadedChars int
+	Fresh       lookup
+}
+
+func dictName(r Region) string {
+	return "transku/" + strings.ToLower(r.ChannelTag+".gob")
+}
+
+func reviewsName(r Region) string {
+	return "transku/" + strings.ToLower(r.ChannelTag+"-reviews.gob")
+}
+
+// newRegionDict sets up a Dictionary for a region from its entries and reviews.
+func (t TransKU) newRegionDict(r Region, cache lookup, reviews reviewBook) (*Dictionary, error) {
+	tag, err := language.Parse(r.BCP47)
+	if err != nil {
+		return nil, err
+	}
+	d := newDictionary(tag, r.attrPolicies(), cache, reviews)
+	d.trk, d.metrics, d.quality, d.policy, d.missing = t.tracker(r), t.metrics, r.qualityCheck(), r.Review, r.Missing
+	return d, nil
+}
+
+// LoadDict reads a region's Dictionary and its reviews from AWS, without adding or translating anything.
+func (t TransKU) LoadDict(r Region) (*Dictionary, error) {
+	log := t.regionLogger(r)
+	dict := lookup{}
+
+	done := step(log, "reading Dictionary from AWS")
+	err := t.aws.Read(dictName(r), &dict)
+	if err != nil {
+		return nil, err
+	}
+	done()
+
+	return t.newRegionDict(r, dict, t.readReviews(r))
+}
+
+// SaveDict writes a region's Dictionary and its reviews to AWS.
+func (t TransKU) SaveDict(r Region, d *Dictionary) error {
+	log := t.regionLogger(r)
+	tlates, reviews := d.cache.snapshot()
+
+	done := step(log, "writing Dictionary to AWS")
+	err := t.aws.Write(dictName(r), tlates)
+	if err != nil {
+		return err
+	}
+	done()
+
+	done = step(log, "writing reviews to AWS")
+	err = t.aws.Write(reviewsName(r), reviews)
+	if err != nil {
+		return err
+	}
+	done()
+
+	return nil
+}
+
+// readReviews reads a region's reviews, starting fresh if there are none.
+func (t TransKU) readReviews(r Region) reviewBook {
+	log := t.regionLogger(r)
+	rb := reviewBook{}
+
+	done := step(log, "reading reviews from AWS")
+	err := t.aws.Read(reviewsName(r), &rb)
+	if err != nil {
+		log.Warn("no reviews found; every entry counts as approved", "err", err)
+		return reviewBook{}
+	}
+	done()
+
+	return rb
+}
+
+// ExportPending writes a region's Dictionary entries awaiting review as CSV.
+func (t TransKU) ExportPending(r Region, w io.Writer) error {
+	d, err := t.LoadDict(r)
+	if err != nil {
+		return err
+	}
+	return d.ExportPending(w)
+}
+
+// ImportReviewed applies reviewed entries from CSV to a region's Dictionary, saving it back to AWS.
+func (t TransKU) ImportReviewed(r Region, rd io.Reader, editor string) (int, error) {
+	d, err := t.LoadDict(r)
+	if err != nil {
+		return 0, err
+	}
+	n, err := d.ImportReviewed(rd, editor)
+	if err != nil {
+		return n, err
+	}
+	t.regionLogger(r).Info("imported reviews", "entries", n, "editor", editor)
+	return n, t.SaveDict(r, d)
+}
+
+// PruneDict drops every entry of a region's Dictionary no product in the catalog uses, saving it back to AWS.
+// Entries keyed by the phrases of older transKU versions are dropped this way, reviews included,
+// so export anything worth keeping first. Only a whole catalog read can tell an entry is unused.
+func (t TransKU) PruneDict(r Region) (int, error) {
+	if !t.createDate.IsZero() || len(t.prods) == 0 {
+		return 0, errors.New("pruning needs the whole catalog read")
+	}
+	d, err := t.LoadDict(r)
+	if err != nil {
+		return 0, err
+	}
+
+	unused := d.unused(t.prods)
+	for _, phrase := range unused {
+		d.cache.remove(phrase)
+	}
+	t.regionLogger(r).Info("pruned Dictionary", "entries", len(unused), "left", d.cache.len())
+	if len(unused) == 0 {
+		return 0, nil
+	}
+	return len(unused), t.SaveDict(r, d)
+}
+
+// LoadRegions reads region definitions from a JSON config file.
+// Attribute values files are found relative to the config file, and every region's policies are validated.
+func LoadRegions(fnm string) ([]Region, error) {
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return nil, err
+	}
+	rs := []Region{}
+	err = json.Unmarshal(b, &rs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rs {
+		if r.Attrs == nil {
+			continue
+		}
+		err = r.Attrs.resolve(filepath.Dir(fnm))
+		if err != nil {
+			return nil, errors.New(strings.ToUpper(r.ChannelTag) + ": " + err.Error())
+		}
+	}
+	return rs, nil
+}
+
+// label gives the ChannelAdvisor label put on a region's products.
+func (r Region) label() string {
+	return `Amazon Seller Central - ` + strings.ToUpper(r.ChannelTag)
+}
+
+// regionDicts keeps region dictionaries loaded for long-running servers.
+type regionDicts struct {
+	t       TransKU
+	regions map[string]Region
+	order   []Region
+
+	dictLock sync.Mutex
+	dicts    map[string]*Dictionary
+}
+
+func newRegionDicts(t TransKU, regions []Region) *regionDicts {
+	rd := &regionDicts{
+		t:       t,
+		regions: map[string]Region{},
+		order:   regions,
+		dicts:   map[string]*Dictionary{},
+	}
+	for _, r := range regions {
+		rd.regions[strings.ToUpper(r.ChannelTag)] = r
+	}
+	return rd
+}
+
+// get gives a region's Dictionary by channel tag, loading it on first use.
+func (rd *regionDicts) get(tag string) (Region, *Dictionary, error) {
+	tag = strings.ToUpper(tag)
+	r, exists := rd.regions[tag]
+	if !exists {
+		return r, nil, os.ErrNotExist
+	}
+
+	rd.dictLock.Lock()
+	defer rd.dictLock.Unlock()
+
+	d, exists := rd.dicts[tag]
+	if exists {
+		return r, d, nil
+	}
+	d, err := rd.t.LoadDict(r)
+	if err != nil {
+		return r, nil, err
+	}
+	rd.dicts[tag] = d
+	return r, d, nil
+}
@@ -0,0 +1,354 @@
+package transku
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// dictUILimit caps how many entries a single search shows.
+const dictUILimit = 200
+
+var dictUITmpl = template.Must(template.New("dictui").Parse(`{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>transKU Dictionary</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+input[type=text] { width: 30em; }
+.pending { background: #fff4d6; } .rejected { background: #fde2e2; } .machine { background: #eef3ff; }
+</style>
+</head>
+<body>
+<p><a href="/">Regions</a></p>
+{{end}}
+
+{{define "regions"}}{{template "head"}}
+<h1>Regions</h1>
+<ul>
+{{range .}}<li><a href="/region/{{.ChannelTag}}">{{.ChannelTag}}</a> ({{.BCP47}})</li>
+{{end}}</ul>
+</body></html>{{end}}
+
+{{define "region"}}{{template "head"}}
+<h1>{{.Tag}}</h1>
+<form method="get">
+<input type="text" name="q" value="{{.Query}}" placeholder="search">
+<select name="in">
+<option value="source"{{if eq .In "source"}} selected{{end}}>source</option>
+<option value="target"{{if eq .In "target"}} selected{{end}}>target</option>
+</select>
+<select name="state">
+<option value="">any state</option>
+{{range .States}}<option value="{{.}}"{{if eq $.State .}} selected{{end}}>{{.}}</option>{{end}}
+</select>
+<button>Search</button>
+</form>
+<p>{{len .Entries}} of {{.Total}} shown</p>
+<table>
+<tr><th>Source</th><th>Translation</th><th>State</th><th>Editor</th><th></th></tr>
+{{range .Entries}}<tr class="{{.State}}">
+<td><a href="/region/{{$.Tag}}/phrase?src={{.Source}}">{{.Source}}</a></td>
+<td colspan="4">
+<form method="post" action="/region/{{$.Tag}}/entry">
+<input type="hidden" name="src" value="{{.Source}}">
+<input type="text" name="translation" value="{{.Translation}}">
+{{$st := .State}}<select name="state">
+{{range $.Settable}}<option value="{{.}}"{{if eq . $st}} selected{{end}}>{{.}}</option>{{end}}
+</select>
+<input type="text" name="editor" value="{{$.Editor}}" placeholder="your name" style="width: 8em">
+<button>Save</button>
+<small>{{.State}}{{if .Editor}} by {{.Editor}}{{end}}</small>
+</form>
+</td>
+</tr>
+{{end}}</table>
+</body></html>{{end}}
+
+{{define "phrase"}}{{template "head"}}
+<h1>{{.Source}}</h1>
+<p><a href="/region/{{.Tag}}">{{.Tag}}</a></p>
+<table>
+<tr><th>Translation</th><td>{{.Translation}}</td></tr>
+<tr><th>State</th><td>{{.State}}</td></tr>
+<tr><th>Machine</th><td>{{.Machine}}</td></tr>
+<tr><th>Issues</th><td>{{range .Issues}}{{.}}; {{end}}</td></tr>
+<tr><th>Editor</th><td>{{.Editor}}</td></tr>
+</table>
+<h2>Used by {{len .SKUs}} SKUs</h2>
+<ul>
+{{range .SKUs}}<li>{{.}}</li>
+{{end}}</ul>
+</body></html>{{end}}
+`))
+
+// dictEntry is a Dictionary entry as shown in the UI.
+type dictEntry struct {
+	Source      string
+	Translation string
+	State       ReviewState
+	Machine     string
+	Issues      []QualityIssue
+	Editor      string
+}
+
+// dictUI serves region dictionaries for browsing and editing.
+type dictUI struct {
+	*regionDicts
+
+	lock  sync.Mutex
+	usage map[string]map[string][]string
+}
+
+// ServeDictUI serves a local web UI for browsing and editing region dictionaries until it fails.
+// Edits are saved straight back to AWS under the editor's name.
+func (t TransKU) ServeDictUI(addr string, regions []Region) error {
+	ui := &dictUI{
+		regionDicts: newRegionDicts(t, regions),
+		usage:       map[string]map[string][]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ui.index)
+	mux.HandleFunc("/region/", ui.route)
+
+	t.logger().Info("serving Dictionary UI", "addr", addr)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
+
+// skus gives every SKU using a phrase in a region, indexing products on first use.
+func (ui *dictUI) skus(tag string, d *Dictionary, phrase string) []string {
+	ui.lock.Lock()
+	defer ui.lock.Unlock()
+
+	usage, exists := ui.usage[tag]
+	if !exists {
+		usage = d.phraseSKUs(ui.t.prods)
+		ui.usage[tag] = usage
+	}
+	return usage[phrase]
+}
+
+// pathParts splits what follows prefix in a request path.
+// Routes are matched by hand, since the module builds without Go 1.22 method and wildcard patterns.
+func pathParts(req *http.Request, prefix string) []string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/"), "/")
+}
+
+// allow answers 405 unless the request uses method.
+func allow(w http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method == method || (method == http.MethodGet && req.Method == http.MethodHead) {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// sameOrigin reports whether a request came from a page served by this UI, so other sites cannot post edits.
+func sameOrigin(req *http.Request) bool {
+	from := req.Header.Get("Origin")
+	if len(from) == 0 {
+		from = req.Header.Get("Referer")
+	}
+	u, err := url.Parse(from)
+	return err == nil && len(u.Host) > 0 && u.Host == req.Host
+}
+
+func (ui *dictUI) index(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	if !allow(w, req, http.MethodGet) {
+		return
+	}
+	ui.render(w, "regions", ui.order)
+}
+
+// route serves '/region/{tag}', '/region/{tag}/phrase' and '/region/{tag}/entry'.
+func (ui *dictUI) route(w http.ResponseWriter, req *http.Request) {
+	parts := pathParts(req, "/region/")
+	tag := strings.ToUpper(parts[0])
+	if len(tag) == 0 || len(parts) > 2 {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if allow(w, req, http.MethodGet) {
+			ui.region(w, req, tag)
+		}
+	case parts[1] == "phrase":
+		if allow(w, req, http.MethodGet) {
+			ui.phrase(w, req, tag)
+		}
+	case parts[1] == "entry":
+		if allow(w, req, http.MethodPost) {
+			ui.entry(w, req, tag)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (ui *dictUI) region(w http.ResponseWriter, req *http.Request, tag string) {
+	_, d, err := ui.get(tag)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+
+	q := strings.ToLower(req.FormValue("q"))
+	in := req.FormValue("in")
+	if in != "target" {
+		in = "source"
+	}
+	st := ReviewState(req.FormValue("state"))
+
+	entries := d.entries(func(e dictEntry) bool {
+		if len(st) > 0 && e.State != st {
+			return false
+		}
+		text := e.Source
+		if in == "target" {
+			text = e.Translation
+		}
+		return strings.Contains(strings.ToLower(text), q)
+	})
+	total := len(entries)
+	if len(entries) > dictUILimit {
+		entries = entries[:dictUILimit]
+	}
+
+	editor := ""
+	if c, err := req.Cookie("editor"); err == nil {
+		editor = c.Value
+	}
+
+	ui.render(w, "region", map[string]interface{}{
+		"Tag":      tag,
+		"Query":    req.FormValue("q"),
+		"In":       in,
+		"State":    st,
+		"States":   []ReviewState{ReviewApproved, ReviewPending, ReviewMachine, ReviewRejected},
+		"Settable": []ReviewState{ReviewApproved, ReviewPending, ReviewRejected},
+		"Entries":  entries,
+		"Total":    total,
+		"Editor":   editor,
+	})
+}
+
+func (ui *dictUI) phrase(w http.ResponseWriter, req *http.Request, tag string) {
+	_, d, err := ui.get(tag)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+
+	src := req.FormValue("src")
+	entries := d.entries(func(e dictEntry) bool { return e.Source == src })
+	if len(entries) == 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	ui.render(w, "phrase", struct {
+		dictEntry
+		Tag  string
+		SKUs []string
+	}{entries[0], tag, ui.skus(tag, d, src)})
+}
+
+func (ui *dictUI) entry(w http.ResponseWriter, req *http.Request, tag string) {
+	if !sameOrigin(req) {
+		http.Error(w, "cross-origin edit refused", http.StatusForbidden)
+		return
+	}
+	r, d, err := ui.get(tag)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+
+	editor := strings.TrimSpace(req.FormValue("editor"))
+	if len(editor) == 0 {
+		http.Error(w, "editor name required", http.StatusBadRequest)
+		return
+	}
+	src := req.FormValue("src")
+	err = d.SetEntry(src, req.FormValue("translation"), ReviewState(req.FormValue("state")), editor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = ui.t.SaveDict(r, d)
+	if err != nil {
+		ui.fail(w, err)
+		return
+	}
+	ui.t.regionLogger(r).Info("Dictionary entry edited", "phrase", src, "editor", editor)
+
+	http.SetCookie(w, &http.Cookie{Name: "editor", Value: editor, Path: "/", SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, req, "/region/"+tag+"/phrase?src="+template.URLQueryEscaper(src), http.StatusSeeOther)
+}
+
+func (ui *dictUI) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dictUITmpl.ExecuteTemplate(w, name, data)
+	if err != nil {
+		ui.t.logger().Error("rendering Dictionary UI", "err", err)
+	}
+}
+
+func (ui *dictUI) fail(w http.ResponseWriter, err error) {
+	if os.IsNotExist(err) {
+		http.Error(w, "unknown region", http.StatusNotFound)
+		return
+	}
+	ui.t.logger().Error("Dictionary UI", "err", err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// entries gives every Dictionary entry keep accepts, sorted by source.
+func (dict *Dictionary) entries(keep func(dictEntry) bool) []dictEntry {
+	entries := []dictEntry{}
+	dict.cache.each(func(src string, e entry) {
+		de := dictEntry{
+			Source:      src,
+			Translation: e.tlate,
+			State:       e.state(),
+			Machine:     e.rv.Machine,
+			Issues:      e.rv.Issues,
+			Editor:      e.rv.Editor,
+		}
+		if keep(de) {
+			entries = append(entries, de)
+		}
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Source < entries[j].Source })
+	return entries
+}
+
+// phraseSKUs indexes every phrase to the SKUs using it.
+func (dict *Dictionary) phraseSKUs(prods []chapi.Product) map[string][]string {
+	usage := map[string][]string{}
+	for _, prod := range prods {
+		for _, phrase := range dict.productPhrases(prod) {
+			usage[phrase] = append(usage[phrase], prod.Sku)
+		}
+	}
+	return usage
+}
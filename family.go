@@ -0,0 +1,214 @@
+package transku
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// FamilyProblem names the kind of variation family breakage found.
+type FamilyProblem string
+
+const (
+	// OrphanedChild is a child whose parent is not in the batch.
+	OrphanedChild FamilyProblem = "orphaned child"
+
+	// ChildlessParent is a parent that no child in the batch points to.
+	ChildlessParent FamilyProblem = "childless parent"
+
+	// MismatchedRelationship is a child whose 'RelationshipName' differs from its parent.
+	MismatchedRelationship FamilyProblem = "mismatched relationship name"
+
+	// DuplicateVariation is a set of siblings that translated to the same title.
+	DuplicateVariation FamilyProblem = "duplicate variation value"
+)
+
+// FamilyIssue is one broken variation family.
+type FamilyIssue struct {
+	Problem   FamilyProblem
+	ParentSKU string
+	SKUs      []string
+	Detail    string
+}
+
+func (fi FamilyIssue) String() string {
+	return string(fi.Problem) + " [" + fi.ParentSKU + "] " + strings.Join(fi.SKUs, ", ") + ": " + fi.Detail
+}
+
+// FamilyReport holds every variation family issue found in a batch.
+type FamilyReport struct {
+	Issues []FamilyIssue
+}
+
+// OK reports whether no family issues were found.
+func (fr FamilyReport) OK() bool {
+	return len(fr.Issues) == 0
+}
+
+// BrokenSKUs gives every SKU belonging to a broken family, parents included.
+func (fr FamilyReport) BrokenSKUs() map[string]bool {
+	skus := map[string]bool{}
+	for _, fi := range fr.Issues {
+		if len(fi.ParentSKU) > 0 {
+			skus[fi.ParentSKU] = true
+		}
+		for _, sku := range fi.SKUs {
+			skus[sku] = true
+		}
+	}
+	return skus
+}
+
+// CheckFamilies analyzes variation families across products and their international versions.
+func CheckFamilies(prods []chapi.Product, ip IntlProds) FamilyReport {
+	fr := FamilyReport{}
+
+	byID := map[int]chapi.Product{}
+	for _, prod := range prods {
+		if _, exists := byID[prod.ID]; !exists {
+			byID[prod.ID] = prod
+		}
+	}
+
+	kids := map[int][]chapi.Product{}
+	for _, prod := range prods {
+		if prod.IsParent || prod.ParentProductID == 0 {
+			continue
+		}
+		parent, exists := byID[prod.ParentProductID]
+		if !exists {
+			fr.Issues = append(fr.Issues, FamilyIssue{
+				Problem: OrphanedChild,
+				SKUs:    []string{prod.Sku},
+				Detail:  "parent ID " + strconv.Itoa(prod.ParentProductID) + " not in batch",
+			})
+			continue
+		}
+		kids[parent.ID] = append(kids[parent.ID], prod)
+
+		if prod.RelationshipName != parent.RelationshipName {
+			fr.Issues = append(fr.Issues, FamilyIssue{
+				Problem:   MismatchedRelationship,
+				ParentSKU: parent.Sku,
+				SKUs:      []string{prod.Sku},
+				Detail:    "'" + prod.RelationshipName + "' != '" + parent.RelationshipName + "'",
+			})
+		}
+	}
+
+	for _, prod := range prods {
+		if prod.IsParent && len(kids[prod.ID]) == 0 {
+			fr.Issues = append(fr.Issues, FamilyIssue{
+				Problem:   ChildlessParent,
+				ParentSKU: prod.Sku,
+				Detail:    "no children in batch",
+			})
+		}
+	}
+
+	siblings := map[string]map[string][]string{}
+	for _, pre := range ip.pres {
+		if len(pre.VariationParentSKU) == 0 || pre.VariationParentSKU == "Parent" {
+			continue
+		}
+		titles, exists := siblings[pre.VariationParentSKU]
+		if !exists {
+			titles = map[string][]string{}
+			siblings[pre.VariationParentSKU] = titles
+		}
+		title := pre.variationTitle()
+		titles[title] = append(titles[title], pre.InventoryNumber)
+	}
+	for parentSKU, titles := range siblings {
+		for title, skus := range titles {
+			if len(skus) < 2 {
+				continue
+			}
+			fr.Issues = append(fr.Issues, FamilyIssue{
+				Problem:   DuplicateVariation,
+				ParentSKU: parentSKU,
+				SKUs:      skus,
+				Detail:    "'" + title + "'",
+			})
+		}
+	}
+
+	return fr
+}
+
+// variationTitle gives the translated title used to tell siblings apart.
+func (pre PreCSV) variationTitle() string {
+	for _, attr := range pre.attributes {
+		if attr.name == `AMZTitle` {
+			return attr.value
+		}
+	}
+	return pre.AuctionTitle
+}
+
+// Without gives a copy of the international products minus the given SKUs.
+func (ip IntlProds) Without(skus map[string]bool) IntlProds {
+	kept := ip
+	kept.pres = nil
+	for _, pre := range ip.pres {
+		if skus[pre.InventoryNumber] {
+			continue
+		}
+		kept.pres = append(kept.pres, pre)
+	}
+	return kept
+}
+
+// familyID gives the ID a product's variation family goes by: its parent's, or its own outside of a family.
+func familyID(prod chapi.Product) int {
+	if !prod.IsParent && prod.ParentProductID != 0 {
+		return prod.ParentProductID
+	}
+	return prod.ID
+}
+
+// holdFamilies spreads holds across variation families, so no parent or child goes out without the rest.
+// Relatives held only through their family list every phrase holding the family back.
+func holdFamilies(prods []chapi.Product, blocked map[string][]string) {
+	fams := map[int]map[string]bool{}
+	for _, prod := range prods {
+		id := familyID(prod)
+		phrases, held := blocked[prod.Sku]
+		if !held || id == 0 {
+			continue
+		}
+		if fams[id] == nil {
+			fams[id] = map[string]bool{}
+		}
+		for _, phrase := range phrases {
+			fams[id][phrase] = true
+		}
+	}
+
+	for _, prod := range prods {
+		fam, held := fams[familyID(prod)]
+		if !held {
+			continue
+		}
+		if _, exists := blocked[prod.Sku]; !exists {
+			blocked[prod.Sku] = sortedKeys(fam)
+		}
+	}
+}
+
+// skipFamilies spreads skips across variation families, as holdFamilies does with holds.
+func skipFamilies(prods []chapi.Product, skipped map[string]bool) {
+	fams := map[int]bool{}
+	for _, prod := range prods {
+		if id := familyID(prod); skipped[prod.Sku] && id != 0 {
+			fams[id] = true
+		}
+	}
+
+	for _, prod := range prods {
+		if fams[familyID(prod)] {
+			skipped[prod.Sku] = true
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package transku
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxSheet = "Sheet1"
+
+// csvColumns are the fixed, non-attribute columns of the CSV layout in order.
+var csvColumns = []string{
+	`Inventory Number`,
+	`Auction Title`,
+	`Brand`,
+	`Buy It Now Price`,
+	`Classification`,
+	`Description`,
+	`Labels`,
+	`Picture URLs`,
+	`Relationship Name`,
+	`Retail Price`,
+	`Seller Cost`,
+	`UPC`,
+	`Variation Parent SKU`,
+	`Weight`,
+}
+
+type jsonAttr struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type jsonPre struct {
+	PreCSV
+	Attributes []jsonAttr `json:"Attributes"`
+}
+
+func (pre PreCSV) json() jsonPre {
+	jpre := jsonPre{PreCSV: pre, Attributes: []jsonAttr{}}
+	for _, attr := range pre.attributes {
+		jpre.Attributes = append(jpre.Attributes, jsonAttr{attr.name, attr.value})
+	}
+	return jpre
+}
+
+type jsonProds struct {
+	ProfileID int       `json:"profile_id"`
+	Products  []jsonPre `json:"products"`
+}
+
+// SaveFile writes international products to disk for review, picking the format by extension.
+func (ip IntlProds) SaveFile(fnm string) error {
+	done := step(logger.With("file", fnm), "saving international products")
+
+	var err error
+	switch strings.ToLower(filepath.Ext(fnm)) {
+	case ".csv":
+		err = ip.saveCSV(fnm, RFC4180)
+	case ".tsv", ".txt":
+		err = ip.saveCSV(fnm, ChannelAdvisorTSV)
+	case ".xlsx":
+		err = ip.saveXLSX(fnm)
+	case ".json":
+		err = ip.saveJSON(fnm)
+	default:
+		err = errors.New("unknown file format '" + filepath.Ext(fnm) + "'")
+	}
+	if err != nil {
+		return err
+	}
+
+	done()
+	return nil
+}
+
+func (ip IntlProds) saveCSV(fnm string, cf CSVFormat) error {
+	f, err := os.Create(fnm)
+	if err != nil {
+		return err
+	}
+	err = ip.WriteCSV(f, cf)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (ip IntlProds) saveXLSX(fnm string) error {
+	layout, _ := ip.GetCSVLayout()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for i, row := range layout {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return err
+		}
+		err = f.SetSheetRow(xlsxSheet, cell, &row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.SaveAs(fnm)
+}
+
+func (ip IntlProds) saveJSON(fnm string) error {
+	jp := jsonProds{ProfileID: ip.profileID}
+	for _, pre := range ip.pres {
+		jp.Products = append(jp.Products, pre.json())
+	}
+
+	b, err := json.MarshalIndent(jp, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fnm), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fnm, b, 0644)
+}
+
+// LoadIntlProds reads international products back from a saved, possibly hand-edited, file.
+// The profileID is only used for formats that do not carry one (CSV, TSV, XLSX).
+func LoadIntlProds(fnm string, profileID int) (IntlProds, error) {
+	done := step(logger.With("file", fnm), "loading international products")
+
+	var layout [][]string
+	var err error
+	switch strings.ToLower(filepath.Ext(fnm)) {
+	case ".csv":
+		layout, err = loadCSV(fnm, RFC4180)
+	case ".tsv", ".txt":
+		layout, err = loadCSV(fnm, ChannelAdvisorTSV)
+	case ".xlsx":
+		layout, err = loadXLSX(fnm)
+	case ".json":
+		ip, err := loadJSON(fnm)
+		if err != nil {
+			return ip, err
+		}
+		done()
+		return ip, nil
+	default:
+		err = errors.New("unknown file format '" + filepath.Ext(fnm) + "'")
+	}
+	if err != nil {
+		return IntlProds{}, err
+	}
+
+	ip, err := fromLayout(layout, profileID)
+	if err != nil {
+		return ip, err
+	}
+
+	done()
+	return ip, nil
+}
+
+func loadCSV(fnm string, cf CSVFormat) ([][]string, error) {
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(b), utf8BOM)))
+	r.Comma = cf.Comma
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+func loadXLSX(fnm string) ([][]string, error) {
+	f, err := excelize.OpenFile(fnm)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.GetRows(f.GetSheetName(0))
+}
+
+func loadJSON(fnm string) (IntlProds, error) {
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return IntlProds{}, err
+	}
+
+	jp := jsonProds{}
+	err = json.Unmarshal(b, &jp)
+	if err != nil {
+		return IntlProds{}, err
+	}
+
+	ip := IntlProds{profileID: jp.ProfileID}
+	for _, jpre := range jp.Products {
+		pre := jpre.PreCSV
+		for _, attr := range jpre.Attributes {
+			pre.attributes = append(pre.attributes, attrkv{attr.Name, attr.Value})
+		}
+		ip.pres = append(ip.pres, pre)
+	}
+	return ip, nil
+}
+
+// fromLayout rebuilds international products from a CSV layout, header row first.
+func fromLayout(layout [][]string, profileID int) (IntlProds, error) {
+	ip := IntlProds{profileID: profileID}
+	if len(layout) == 0 {
+		return ip, errors.New("empty layout")
+	}
+
+	head := layout[0]
+	cols := map[string]int{}
+	for i, name := range head {
+		cols[name] = i
+	}
+	for _, name := range csvColumns {
+		if _, exists := cols[name]; !exists {
+			return ip, errors.New("missing column '" + name + "'")
+		}
+	}
+
+	pairs := [][2]int{}
+	extra := []int{}
+	for i, name := range head {
+		if strings.HasPrefix(name, `Attribute`) && strings.HasSuffix(name, `Name`) {
+			n := strings.TrimSuffix(strings.TrimPrefix(name, `Attribute`), `Name`)
+			if _, err := strconv.Atoi(n); err == nil {
+				if v, exists := cols[`Attribute`+n+`Value`]; exists {
+					pairs = append(pairs, [2]int{i, v})
+					continue
+				}
+			}
+		}
+		if strings.HasPrefix(name, `Attribute`) && strings.HasSuffix(name, `Value`) {
+			continue
+		}
+		if contains(csvColumns, name) {
+			continue
+		}
+		extra = append(extra, i)
+	}
+	if len(pairs) == 0 && len(extra) > 0 {
+		ip.layout = AttrColumns
+	}
+
+	for r, row := range layout[1:] {
+		if len(row) < len(head) {
+			row = append(row, make([]string, len(head)-len(row))...)
+		}
+		cell := func(name string) string {
+			return row[cols[name]]
+		}
+
+		pre := PreCSV{
+			InventoryNumber:    cell(`Inventory Number`),
+			AuctionTitle:       cell(`Auction Title`),
+			Brand:              cell(`Brand`),
+			BuyItNowPrice:      cell(`Buy It Now Price`),
+			Classification:     cell(`Classification`),
+			Description:        cell(`Description`),
+			Labels:             cell(`Labels`),
+			PictureURLs:        cell(`Picture URLs`),
+			RelationshipName:   cell(`Relationship Name`),
+			RetailPrice:        cell(`Retail Price`),
+			SellerCost:         cell(`Seller Cost`),
+			UPC:                cell(`UPC`),
+			VariationParentSKU: cell(`Variation Parent SKU`),
+			Weight:             cell(`Weight`),
+		}
+		if len(pre.InventoryNumber) == 0 {
+			return ip, errors.New("empty inventory number (sku) @ row-" + strconv.Itoa(r+2))
+		}
+
+		for _, pair := range pairs {
+			if len(row[pair[0]]) == 0 {
+				continue
+			}
+			pre.attributes = append(pre.attributes, attrkv{row[pair[0]], row[pair[1]]})
+		}
+		for _, i := range extra {
+			if len(row[i]) == 0 {
+				continue
+			}
+			pre.attributes = append(pre.attributes, attrkv{head[i], row[i]})
+		}
+
+		ip.pres = append(ip.pres, pre)
+	}
+
+	return ip, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, itm := range list {
+		if itm == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package transku
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLAttrs holds every HTML attribute translated along with text.
+var HTMLAttrs = map[string]bool{
+	`alt`:   true,
+	`title`: true,
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\u00a0", "&nbsp;", `"`, "&quot;")
+)
+
+// addHTML segments the text nodes and HTMLAttrs of HTML, keeping the markup around them as is.
+// Text is decoded before segmenting and re-encoded on the way out; script and style content is left alone.
+func (m *masked) addHTML(text, brand string) {
+	z := html.NewTokenizer(strings.NewReader(text))
+	skip := false
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return
+
+		case html.TextToken:
+			if skip {
+				m.lit(string(z.Raw()))
+				continue
+			}
+			m.addText(string(z.Text()), brand, textEscaper)
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := string(z.Raw())
+			tok := z.Token()
+			if tt == html.StartTagToken && (tok.DataAtom == atom.Script || tok.DataAtom == atom.Style) {
+				skip = true
+			}
+			if !hasHTMLAttr(tok) {
+				m.lit(raw)
+				continue
+			}
+
+			m.lit("<" + tok.Data)
+			for _, a := range tok.Attr {
+				m.lit(" " + a.Key + `="`)
+				if HTMLAttrs[a.Key] {
+					m.addText(a.Val, brand, attrEscaper)
+				} else {
+					m.lit(attrEscaper.Replace(a.Val))
+				}
+				m.lit(`"`)
+			}
+			if tt == html.SelfClosingTagToken {
+				m.lit("/")
+			}
+			m.lit(">")
+
+		case html.EndTagToken:
+			tok := z.Token()
+			if tok.DataAtom == atom.Script || tok.DataAtom == atom.Style {
+				skip = false
+			}
+			m.lit(string(z.Raw()))
+
+		default:
+			m.lit(string(z.Raw()))
+		}
+	}
+}
+
+func hasHTMLAttr(tok html.Token) bool {
+	for _, a := range tok.Attr {
+		if HTMLAttrs[a.Key] && len(strings.TrimSpace(a.Val)) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package transku
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// shout translates a segment to upper case, keeping its placeholders.
+func shout(t *testing.T) func(segment) string {
+	return func(seg segment) string {
+		b := strings.Builder{}
+		last := 0
+		for _, loc := range placeholderRegex.FindAllStringIndex(seg.text, -1) {
+			b.WriteString(strings.ToUpper(seg.text[last:loc[0]]) + seg.text[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		b.WriteString(strings.ToUpper(seg.text[last:]))
+
+		out, err := seg.restore(b.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+}
+
+func TestMaskHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		text  string
+		segs  []string
+		same  string
+		tlate string
+	}{
+		{
+			"text nodes",
+			"<p>Pack of 3 (Large)</p><ul><li>Soft shirt</li></ul>",
+			[]string{"Pack of ⟦n1⟧ (Large)", "Soft shirt"},
+			"<p>Pack of 3 (Large)</p><ul><li>Soft shirt</li></ul>",
+			"<p>PACK OF 3 (LARGE)</p><ul><li>SOFT SHIRT</li></ul>",
+		},
+		{
+			"entities",
+			"<p>Salt &amp; pepper.&nbsp;Holds 2 oz &lt;each&gt;</p>",
+			[]string{"Salt & pepper", "Holds ⟦n1⟧ ⟦n2⟧each"},
+			"<p>Salt &amp; pepper.&nbsp;Holds 2 oz &lt;each&gt;</p>",
+			"<p>SALT &amp; PEPPER.&nbsp;HOLDS 2 oz &lt;EACH&gt;</p>",
+		},
+		{
+			"attribute with bracket",
+			`<p class="a>b">Red mug</p>`,
+			[]string{"Red mug"},
+			`<p class="a>b">Red mug</p>`,
+			`<p class="a>b">RED MUG</p>`,
+		},
+		{
+			"alt and title",
+			`<img src="mug.png" alt="Red Acme mug" title='Big "mug"'>`,
+			[]string{"Red ⟦b1⟧ mug", `Big "mug`},
+			`<img src="mug.png" alt="Red Acme mug" title="Big &quot;mug&quot;">`,
+			`<img src="mug.png" alt="RED Acme MUG" title="BIG &quot;MUG&quot;">`,
+		},
+		{
+			"empty alt",
+			`<img src="mug.png" alt="">`,
+			[]string{},
+			`<img src="mug.png" alt="">`,
+			`<img src="mug.png" alt="">`,
+		},
+		{
+			"script and style",
+			`<style>p { color: red }</style><script>var x = "Do not translate";</script><p>Translate me</p>`,
+			[]string{"Translate me"},
+			`<style>p { color: red }</style><script>var x = "Do not translate";</script><p>Translate me</p>`,
+			`<style>p { color: red }</style><script>var x = "Do not translate";</script><p>TRANSLATE ME</p>`,
+		},
+		{
+			"self closing",
+			"Line one<br/>Line two",
+			[]string{"Line one", "Line two"},
+			"Line one<br/>Line two",
+			"LINE ONE<br/>LINE TWO",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mask(tc.text, "Acme")
+			if got := segTexts(m); !reflect.DeepEqual(got, tc.segs) {
+				t.Fatalf("segments %q, want %q", got, tc.segs)
+			}
+			if got := m.join(unchanged(t)); got != tc.same {
+				t.Fatalf("joined '%s', want '%s'", got, tc.same)
+			}
+			if got := m.join(shout(t)); got != tc.tlate {
+				t.Fatalf("translated '%s', want '%s'", got, tc.tlate)
+			}
+		})
+	}
+}
+
+func TestMaskPlainText(t *testing.T) {
+	// text without tags is never decoded or re-encoded
+	text := "Plain 5 < 6 & more"
+	m := mask(text, "")
+	if got := m.join(shout(t)); got != "PLAIN 5 < 6 & MORE" {
+		t.Fatalf("translated '%s'", got)
+	}
+}
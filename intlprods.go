@@ -2,24 +2,44 @@ package transku
 
 import (
 	"errors"
-	"log"
+	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 
 	"golang.org/x/text/language"
 
 	"github.com/WedgeNix/chapi"
-	"github.com/WedgeNix/util"
 )
 
 // IntlProds holds info for international products.
 type IntlProds struct {
 	pres      []PreCSV
 	profileID int
+	layout    AttrLayout
+	region    Region
+	families  FamilyReport
+	skipped   []string
+
+	// trans is what translating the products held back or found missing.
+	trans TransResult
+
+	// attrOrder is every attribute name the region's policies export, laid out ahead of any others.
+	attrOrder []string
 }
 
+// AttrLayout decides how attributes are laid out as CSV columns.
+type AttrLayout int
+
+const (
+	// AttrPairs gives every attribute name a fixed 'AttributeNName/Value' pair, in attrNames order.
+	AttrPairs AttrLayout = iota
+
+	// AttrColumns gives every attribute name its own dedicated column.
+	AttrColumns
+)
+
 type attrkv struct {
 	name  string
 	value string
@@ -45,11 +65,13 @@ type PreCSV struct {
 	attributes []attrkv
 }
 
-// New creates proper international products.
-func newIntlProds(prods []chapi.Product, profileID int, label string, lang language.Tag) (IntlProds, error) {
-	ip := IntlProds{profileID: profileID}
+// New creates proper international products, looking variation parents up in ps.
+func newIntlProds(prods []chapi.Product, ps parentSKUs, profileID int, label string, lang language.Tag, attrs AttrPolicies, trk tracker) (ip IntlProds, err error) {
+	ip = IntlProds{profileID: profileID, attrOrder: attrs.exportNames()}
+	log := trk.log
 
-	ps := parentSKUs{}
+	prog := trk.start("convert products", len(prods))
+	defer func() { prog.end(err) }()
 	for i, prod := range prods {
 
 		if lang == language.English {
@@ -72,7 +94,7 @@ func newIntlProds(prods []chapi.Product, profileID int, label string, lang langu
 			RetailPrice:        strconv.FormatFloat(prod.RetailPrice, 'f', 2, 64),
 			SellerCost:         strconv.FormatFloat(prod.Cost, 'f', 2, 64),
 			UPC:                prod.UPC,
-			VariationParentSKU: ps.getVariationParentSKU(prod, prods),
+			VariationParentSKU: ps.getVariationParentSKU(prod),
 			Weight:             strconv.FormatFloat(prod.Weight, 'f', 2, 64),
 		}
 
@@ -110,7 +132,11 @@ func newIntlProds(prods []chapi.Product, profileID int, label string, lang langu
 			return ip, errors.New("empty 'Weight'")
 		}
 		if len(p.VariationParentSKU) == 0 {
-			log.Println("empty 'VariationParentSKU' for " + p.InventoryNumber)
+			if prod.ParentProductID != 0 {
+				log.Warn("orphaned child", "sku", p.InventoryNumber, "parent_id", prod.ParentProductID)
+			} else {
+				log.Debug("empty 'VariationParentSKU'", "sku", p.InventoryNumber)
+			}
 		}
 
 		urls := []string{}
@@ -120,18 +146,16 @@ func newIntlProds(prods []chapi.Product, profileID int, label string, lang langu
 		if len(urls) == 0 {
 			return ip, errors.New("no 'PictureURLs' found")
 		}
-		p.PictureURLs = `"` + strings.Join(urls, ",") + `"`
+		p.PictureURLs = strings.Join(urls, ",")
 
-		for _, attr := range prod.Attributes {
-			_, exists := FilterAttr[attr.Name]
-			if !exists {
-				continue
-			}
-			p.attributes = append(p.attributes, attrkv{attr.Name, attr.Value})
+		var unmapped []attrkv
+		p.attributes, unmapped = attrs.apply(prod.Attributes)
+		for _, attr := range unmapped {
+			log.Warn("attribute value missing from lookup table", "sku", p.InventoryNumber, "attribute", attr.name, "value", attr.value)
 		}
 
 		ip.pres = append(ip.pres, p)
-		util.Log(i+1, "/", len(prods))
+		prog.add(1)
 	}
 
 	return ip, nil
@@ -140,28 +164,22 @@ func newIntlProds(prods []chapi.Product, profileID int, label string, lang langu
 // GetCSVLayout formats the data to suit a CSV layout and gives the profileID.
 func (ip IntlProds) GetCSVLayout() ([][]string, int) {
 	layout := make([][]string, len(ip.pres)+1)
-	layout[0] = []string{
-		`Inventory Number`,
-		`Auction Title`,
-		`Brand`,
-		`Buy It Now Price`,
-		`Classification`,
-		`Description`,
-		`Labels`,
-		`Picture URLs`,
-		`Relationship Name`,
-		`Retail Price`,
-		`Seller Cost`,
-		`UPC`,
-		`Variation Parent SKU`,
-		`Weight`,
-	}
-	for i := range make([]int, len(FilterAttr)) {
-		n := strconv.Itoa(i + 1)
-		layout[0] = append(layout[0], []string{
-			`Attribute` + n + `Name`,
-			`Attribute` + n + `Value`,
-		}...)
+	layout[0] = append([]string{}, csvColumns...)
+
+	names := ip.attrNames()
+	slots := map[string]int{}
+	for i, name := range names {
+		slots[name] = i
+		switch ip.layout {
+		case AttrColumns:
+			layout[0] = append(layout[0], name)
+		default:
+			n := strconv.Itoa(i + 1)
+			layout[0] = append(layout[0], []string{
+				`Attribute` + n + `Name`,
+				`Attribute` + n + `Value`,
+			}...)
+		}
 	}
 
 	work := sync.WaitGroup{}
@@ -186,9 +204,7 @@ func (ip IntlProds) GetCSVLayout() ([][]string, int) {
 				pre.VariationParentSKU,
 				pre.Weight,
 			}
-			for _, attr := range pre.attributes {
-				layout[i] = append(layout[i], []string{attr.name, attr.value}...)
-			}
+			layout[i] = append(layout[i], ip.attrCells(pre, slots)...)
 		}(i+1, pre)
 	}
 	work.Wait()
@@ -196,51 +212,76 @@ func (ip IntlProds) GetCSVLayout() ([][]string, int) {
 	return layout, ip.profileID
 }
 
-type parentSKUs map[int]string
-
-func (ps parentSKUs) getVariationParentSKU(prod chapi.Product, prods []chapi.Product) string {
-	// t := time.Now()
-
-	if prod.IsParent {
-		// util.Log("[getVariationParentSKU] IsParent")
-		return "Parent"
+// attrNames gives every exported attribute name: those the region's policies export, sorted,
+// followed by any found only in the data, sorted. Slots stay put between batches and runs
+// as long as the policies do.
+func (ip IntlProds) attrNames() []string {
+	seen := map[string]bool{}
+	for _, name := range ip.attrOrder {
+		seen[name] = true
 	}
-	sku, exists := ps[prod.ParentProductID]
-	if exists {
-		// util.Log("[getVariationParentSKU] CacheHit")
-		return sku
+	extra := []string{}
+	for _, pre := range ip.pres {
+		for _, attr := range pre.attributes {
+			if seen[attr.name] {
+				continue
+			}
+			seen[attr.name] = true
+			extra = append(extra, attr.name)
+		}
 	}
+	sort.Strings(extra)
+	return append(append([]string{}, ip.attrOrder...), extra...)
+}
 
-	skuc := make(chan string)
+// attrCells lays a row's attributes into their slots, padding the ones it lacks.
+func (ip IntlProds) attrCells(pre PreCSV, slots map[string]int) []string {
+	switch ip.layout {
+	case AttrColumns:
+		cells := make([]string, len(slots))
+		for _, attr := range pre.attributes {
+			cells[slots[attr.name]] = attr.value
+		}
+		return cells
+	default:
+		cells := make([]string, 2*len(slots))
+		for _, attr := range pre.attributes {
+			i := slots[attr.name]
+			cells[2*i] = attr.name
+			cells[2*i+1] = attr.value
+		}
+		return cells
+	}
+}
 
-	var misswg sync.WaitGroup
-	var miss uint64
+// parentSKUs indexes every product ID to its SKU for variation parent lookups.
+type parentSKUs struct {
+	skus map[int]string
+	dups map[int][]string
+}
 
+func newParentSKUs(prods []chapi.Product, log *slog.Logger) parentSKUs {
+	ps := parentSKUs{skus: map[int]string{}, dups: map[int][]string{}}
 	for _, p := range prods {
-		misswg.Add(1)
-		p := p
-		go func() {
-			if prod.ParentProductID != p.ID {
-				atomic.AddUint64(&miss, 1)
-				misswg.Done()
-				return
-			}
-			misswg.Done()
-			skuc <- p.Sku
-		}()
+		sku, exists := ps.skus[p.ID]
+		if !exists {
+			ps.skus[p.ID] = p.Sku
+			continue
+		}
+		if len(ps.dups[p.ID]) == 0 {
+			ps.dups[p.ID] = []string{sku}
+		}
+		ps.dups[p.ID] = append(ps.dups[p.ID], p.Sku)
 	}
-
-	misswg.Wait()
-	if int(atomic.LoadUint64(&miss)) == len(prods) {
-		sku = ""
-		ps[prod.ParentProductID] = sku
-		// util.Log("[getVariationParentSKU] [miss] ", time.Since(t).Nanoseconds(), "ns")
-		return sku
+	for id, skus := range ps.dups {
+		log.Warn("duplicate product ID", "id", id, "skus", skus)
 	}
+	return ps
+}
 
-	sku = <-skuc
-	ps[prod.ParentProductID] = sku
-
-	// util.Log("[getVariationParentSKU] ", time.Since(t).Nanoseconds(), "ns")
-	return sku
+func (ps parentSKUs) getVariationParentSKU(prod chapi.Product) string {
+	if prod.IsParent {
+		return "Parent"
+	}
+	return ps.skus[prod.ParentProductID]
 }
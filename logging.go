@@ -0,0 +1,49 @@
+package transku
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// progressEvery is the least time between two progress summaries.
+const progressEvery = 5 * time.Second
+
+var (
+	logLevel = new(slog.LevelVar)
+	logger   = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+)
+
+// SetLogger replaces the logger every transKU message goes through.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// SetQuiet only lets warnings and errors through the default logger.
+func SetQuiet(quiet bool) {
+	if quiet {
+		logLevel.Set(slog.LevelWarn)
+		return
+	}
+	logLevel.Set(slog.LevelInfo)
+}
+
+// logger gives the run's logger.
+func (t TransKU) logger() *slog.Logger {
+	return logger.With("run", t.run)
+}
+
+// regionLogger gives the run's logger for a single region.
+func (t TransKU) regionLogger(r Region) *slog.Logger {
+	return t.logger().With("region", strings.ToUpper(r.ChannelTag))
+}
+
+// step logs the start of a step, giving a func that logs its end with the time taken.
+func step(l *slog.Logger, msg string) func() {
+	l.Debug(msg + "...")
+	start := time.Now()
+	return func() {
+		l.Info(msg, "took", time.Since(start).Round(time.Millisecond))
+	}
+}
@@ -0,0 +1,261 @@
+package transku
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metric names, all labelled by region.
+const (
+	MetricProductsRead       = "transku_products_read_total"
+	MetricPhrasesExtracted   = "transku_phrases_extracted_total"
+	MetricCacheHits          = "transku_cache_hits_total"
+	MetricCacheMisses        = "transku_cache_misses_total"
+	MetricPhrasesTranslated  = "transku_phrases_translated_total"
+	MetricTranslationSeconds = "transku_translation_seconds"
+	MetricCharactersBilled   = "transku_characters_billed_total"
+	MetricValidationFailures = "transku_validation_failures_total"
+	MetricRowsUploaded       = "transku_rows_uploaded_total"
+)
+
+var metricHelp = map[string]string{
+	MetricProductsRead:       "Products read from ChannelAdvisor.",
+	MetricPhrasesExtracted:   "Phrases extracted from products.",
+	MetricCacheHits:          "Extracted phrases already in the Dictionary.",
+	MetricCacheMisses:        "Extracted phrases new to the Dictionary.",
+	MetricPhrasesTranslated:  "Phrases sent to the translator.",
+	MetricTranslationSeconds: "Time taken by a single translation.",
+	MetricCharactersBilled:   "Characters sent to the translator.",
+	MetricValidationFailures: "Products or families failing validation.",
+	MetricRowsUploaded:       "Rows uploaded to ChannelAdvisor.",
+}
+
+// latencyBuckets are the histogram upper bounds for translation latency in seconds.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Metrics holds a run's counters and histograms, labelled by region.
+// A nil *Metrics drops everything.
+type Metrics struct {
+	lock     sync.Mutex
+	counters map[string]map[string]float64
+	hists    map[string]map[string]*histogram
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		counters: map[string]map[string]float64{},
+		hists:    map[string]map[string]*histogram{},
+	}
+}
+
+// Add adds v to a region's counter.
+func (m *Metrics) Add(name, region string, v float64) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	byRegion, exists := m.counters[name]
+	if !exists {
+		byRegion = map[string]float64{}
+		m.counters[name] = byRegion
+	}
+	byRegion[region] += v
+}
+
+// Observe records v in a region's histogram.
+func (m *Metrics) Observe(name, region string, v float64) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	byRegion, exists := m.hists[name]
+	if !exists {
+		byRegion = map[string]*histogram{}
+		m.hists[name] = byRegion
+	}
+	h, exists := byRegion[region]
+	if !exists {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		byRegion[region] = h
+	}
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Counter gives a region's counter value.
+func (m *Metrics) Counter(name, region string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.counters[name][region]
+}
+
+// WriteOpenMetrics writes every metric in the OpenMetrics text format.
+func (m *Metrics) WriteOpenMetrics(w io.Writer) error {
+	if m == nil {
+		_, err := io.WriteString(w, "# EOF\n")
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, name := range sortedKeys(m.counters) {
+		family := name[:len(name)-len("_total")]
+		fmt.Fprintf(w, "# TYPE %s counter\n# HELP %s %s\n", family, family, metricHelp[name])
+		byRegion := m.counters[name]
+		for _, region := range sortedKeys(byRegion) {
+			fmt.Fprintf(w, "%s{region=%q} %s\n", name, region, formatFloat(byRegion[region]))
+		}
+	}
+	for _, name := range sortedKeys(m.hists) {
+		fmt.Fprintf(w, "# TYPE %s histogram\n# HELP %s %s\n", name, name, metricHelp[name])
+		byRegion := m.hists[name]
+		for _, region := range sortedKeys(byRegion) {
+			h := byRegion[region]
+			for i, le := range latencyBuckets {
+				fmt.Fprintf(w, "%s_bucket{region=%q,le=%q} %d\n", name, region, formatFloat(le), h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{region=%q,le=\"+Inf\"} %d\n", name, region, h.count)
+			fmt.Fprintf(w, "%s_count{region=%q} %d\n", name, region, h.count)
+			fmt.Fprintf(w, "%s_sum{region=%q} %s\n", name, region, formatFloat(h.sum))
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// ServeHTTP exposes the metrics for scraping.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	m.WriteOpenMetrics(w)
+}
+
+// RegionSummary is the end-of-run view of a single region's metrics.
+type RegionSummary struct {
+	Counters      map[string]float64 `json:"counters"`
+	CacheHitRatio float64            `json:"cache_hit_ratio"`
+	Translations  uint64             `json:"translations"`
+	AvgLatency    float64            `json:"avg_translation_seconds"`
+}
+
+// Summary gives every region's metrics, keyed by region.
+func (m *Metrics) Summary() map[string]RegionSummary {
+	sums := map[string]RegionSummary{}
+	if m == nil {
+		return sums
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	get := func(region string) RegionSummary {
+		rs, exists := sums[region]
+		if !exists {
+			rs = RegionSummary{Counters: map[string]float64{}}
+		}
+		return rs
+	}
+	for name, byRegion := range m.counters {
+		for region, v := range byRegion {
+			rs := get(region)
+			rs.Counters[name] = v
+			sums[region] = rs
+		}
+	}
+	for region, rs := range sums {
+		hits, misses := rs.Counters[MetricCacheHits], rs.Counters[MetricCacheMisses]
+		if hits+misses > 0 {
+			rs.CacheHitRatio = hits / (hits + misses)
+		}
+		sums[region] = rs
+	}
+	for region, h := range m.hists[MetricTranslationSeconds] {
+		rs := get(region)
+		rs.Translations = h.count
+		if h.count > 0 {
+			rs.AvgLatency = h.sum / float64(h.count)
+		}
+		sums[region] = rs
+	}
+	return sums
+}
+
+// Metrics gives the run's metrics.
+func (t TransKU) Metrics() *Metrics {
+	return t.metrics
+}
+
+// ServeMetrics exposes the run's metrics on a local HTTP endpoint at '/metrics'.
+func (t TransKU) ServeMetrics(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", t.metrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		err := srv.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			t.logger().Error("metrics endpoint stopped", "err", err)
+		}
+	}()
+	t.logger().Info("serving metrics", "addr", ln.Addr().String())
+
+	return srv, nil
+}
+
+// WriteRunSummary writes the run's metrics as a JSON summary.
+func (t TransKU) WriteRunSummary(fnm string) error {
+	b, err := json.MarshalIndent(struct {
+		Run     string                   `json:"run"`
+		Regions map[string]RegionSummary `json:"regions"`
+	}{t.run, t.metrics.Summary()}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fnm, b, 0644)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package transku
+
+import (
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// MissingPolicy decides what GoTransAll does with segments missing from the Dictionary, or translated to nothing.
+type MissingPolicy int
+
+const (
+	// KeepSource leaves the segment in English.
+	KeepSource MissingPolicy = iota
+
+	// TranslateMissing machine translates the segment on the fly, adding it to the Dictionary.
+	TranslateMissing
+
+	// SkipProduct leaves the whole product out, along with its variation family.
+	SkipProduct
+
+	// FailRegion stops the region with an error.
+	FailRegion
+)
+
+// MissingEntry is a product field with a segment missing from the Dictionary, or translated to nothing.
+type MissingEntry struct {
+	SKU     string `json:"sku"`
+	Field   string `json:"field"`
+	Segment string `json:"segment"`
+	Empty   bool   `json:"empty"`
+}
+
+// TransResult is what a single GoTransAll held back or found missing.
+type TransResult struct {
+	// Blocked maps every SKU held for review to the phrases awaiting it.
+	Blocked map[string][]string
+
+	// Missing are the segments missing from the Dictionary, or translated to nothing, by SKU and field.
+	Missing []MissingEntry
+
+	// Skipped are the sorted SKUs left out under SkipProduct, along with their variation families.
+	Skipped []string
+}
+
+// fillMissing gives what a missing or empty segment turns into under the region's MissingPolicy.
+func (dict *Dictionary) fillMissing(seg segment) string {
+	dict.lock.RLock()
+	translate := dict.translate
+	dict.lock.RUnlock()
+
+	if dict.missing != TranslateMissing || translate == nil {
+		return seg.text
+	}
+
+	e := dict.translateOnce(seg.text, translate)
+	if !dict.usable(e) || len(e.tlate) == 0 {
+		return seg.text
+	}
+	return e.tlate
+}
+
+// newPhrases gives every entry translated since the Dictionary was loaded.
+func (dict *Dictionary) newPhrases() lookup {
+	dict.lock.RLock()
+	defer dict.lock.RUnlock()
+
+	fresh := lookup{}
+	for src, tlate := range dict.fresh {
+		fresh[src] = tlate
+	}
+	return fresh
+}
+
+// freshLen counts the entries translated since the Dictionary was loaded, including refilled empty ones.
+func (dict *Dictionary) freshLen() int {
+	dict.lock.RLock()
+	defer dict.lock.RUnlock()
+
+	return len(dict.fresh)
+}
+
+// machineTranslate runs a phrase through the translator, checking the result for review.
+func (dict *Dictionary) machineTranslate(word string, cacheMiss func(string) string) (string, Review) {
+	if dict.lang == language.English {
+		return word, Review{State: ReviewApproved, Updated: time.Now()}
+	}
+
+	start := time.Now()
+	tlate := cacheMiss(word)
+	dict.metrics.Observe(MetricTranslationSeconds, dict.trk.region, time.Since(start).Seconds())
+	dict.metrics.Add(MetricPhrasesTranslated, dict.trk.region, 1)
+	dict.metrics.Add(MetricCharactersBilled, dict.trk.region, float64(len(word)))
+
+	rv := Review{State: ReviewMachine, Machine: tlate, Updated: time.Now()}
+	rv.Issues = dict.quality.Check(word, tlate)
+	if len(rv.Issues) > 0 {
+		dict.trk.log.Warn("quarantined translation", "phrase", word, "translation", tlate, "issues", rv.Issues)
+		rv.State = ReviewPending
+	}
+
+	return tlate, rv
+}
@@ -0,0 +1,170 @@
+package transku
+
+import (
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// observeEvery is the least time between two progress callbacks.
+const observeEvery = 250 * time.Millisecond
+
+// Progress is a snapshot of a long-running stage.
+type Progress struct {
+	Region  string
+	Stage   string
+	Done    int
+	Total   int
+	Elapsed time.Duration
+
+	// Rate is the throughput in items per second.
+	Rate float64
+
+	// ETA is the estimated time left, zero when unknown.
+	ETA time.Duration
+}
+
+// Percent gives how much of the stage is done, from 0 to 100.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 100
+	}
+	return 100 * float64(p.Done) / float64(p.Total)
+}
+
+// Observer watches long-running stages as they happen.
+// Callbacks may come from several goroutines at once.
+type Observer interface {
+	StageStart(region, stage string, total int)
+	StageProgress(p Progress)
+	StageEnd(region, stage string, took time.Duration)
+	StageError(region, stage string, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) StageStart(string, string, int)         {}
+func (nopObserver) StageProgress(Progress)                 {}
+func (nopObserver) StageEnd(string, string, time.Duration) {}
+func (nopObserver) StageError(string, string, error)       {}
+
+// SetObserver has every later stage report to o.
+func (t *TransKU) SetObserver(o Observer) {
+	t.observer = o
+}
+
+// tracker reports a region's stages to its logger and observer.
+type tracker struct {
+	log    *slog.Logger
+	obs    Observer
+	region string
+}
+
+func newTracker(log *slog.Logger, obs Observer, region string) tracker {
+	if obs == nil {
+		obs = nopObserver{}
+	}
+	return tracker{log: log, obs: obs, region: region}
+}
+
+// tracker gives the region's tracker for this run.
+func (t TransKU) tracker(r Region) tracker {
+	return newTracker(t.regionLogger(r), t.observer, strings.ToUpper(r.ChannelTag))
+}
+
+// progress logs periodic summaries of a long-running stage instead of every item,
+// and passes them on to the observer.
+type progress struct {
+	trk     tracker
+	stage   string
+	total   int64
+	start   time.Time
+	done    int64
+	nextLog int64
+	nextObs int64
+	ended   int32
+}
+
+// start begins a stage of total items.
+func (trk tracker) start(stage string, total int) *progress {
+	now := time.Now()
+	trk.obs.StageStart(trk.region, stage, total)
+	p := &progress{
+		trk:     trk,
+		stage:   stage,
+		total:   int64(total),
+		start:   now,
+		nextLog: now.Add(progressEvery).UnixNano(),
+		nextObs: now.Add(observeEvery).UnixNano(),
+	}
+	if total <= 0 {
+		p.end(nil)
+	}
+	return p
+}
+
+// add counts finished items, reporting when a summary is due or everything is done.
+func (p *progress) add(n int) {
+	done := atomic.AddInt64(&p.done, int64(n))
+	now := time.Now()
+	final := done >= p.total
+
+	if due(&p.nextObs, now, observeEvery, final) {
+		p.trk.obs.StageProgress(p.snapshot(done, now))
+	}
+	if final {
+		p.end(nil)
+	}
+	if due(&p.nextLog, now, progressEvery, final) {
+		snap := p.snapshot(done, now)
+		p.trk.log.Info(p.stage,
+			"done", snap.Done,
+			"total", snap.Total,
+			"percent", int(snap.Percent()),
+			"elapsed", snap.Elapsed.Round(time.Second),
+			"eta", snap.ETA.Round(time.Second),
+		)
+	}
+}
+
+// end finishes the stage once, reporting err when it failed.
+func (p *progress) end(err error) {
+	if !atomic.CompareAndSwapInt32(&p.ended, 0, 1) {
+		return
+	}
+	if err != nil {
+		p.trk.obs.StageError(p.trk.region, p.stage, err)
+		return
+	}
+	p.trk.obs.StageEnd(p.trk.region, p.stage, time.Since(p.start))
+}
+
+func (p *progress) snapshot(done int64, now time.Time) Progress {
+	snap := Progress{
+		Region:  p.trk.region,
+		Stage:   p.stage,
+		Done:    int(done),
+		Total:   int(p.total),
+		Elapsed: now.Sub(p.start),
+	}
+	if secs := snap.Elapsed.Seconds(); secs > 0 {
+		snap.Rate = float64(done) / secs
+	}
+	if snap.Rate > 0 && done < p.total {
+		snap.ETA = time.Duration(float64(p.total-done) / snap.Rate * float64(time.Second))
+	}
+	return snap
+}
+
+// due reports whether a throttled report should go out, claiming the next slot if so.
+func due(next *int64, now time.Time, every time.Duration, final bool) bool {
+	if final {
+		return true
+	}
+	at := atomic.LoadInt64(next)
+	if now.UnixNano() < at {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(next, at, now.Add(every).UnixNano())
+}
@@ -0,0 +1,342 @@
+package transku
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// AttrAction is what happens to an attribute on its way to a region.
+type AttrAction string
+
+const (
+	// AttrDrop leaves the attribute out of the region entirely.
+	AttrDrop AttrAction = "drop"
+
+	// AttrExport passes the attribute through untranslated.
+	AttrExport AttrAction = "export"
+
+	// AttrTranslate translates the attribute value before exporting it.
+	AttrTranslate AttrAction = "translate"
+
+	// AttrConstant exports the attribute with a fixed value for every product.
+	AttrConstant AttrAction = "constant"
+
+	// AttrMap exports the attribute value through a lookup table instead of translating it.
+	AttrMap AttrAction = "map"
+)
+
+// AttrPolicy decides how a single attribute is handled for a region.
+type AttrPolicy struct {
+	Action AttrAction `json:"action"`
+
+	// Rename exports the attribute under a different name when set.
+	Rename string `json:"rename,omitempty"`
+
+	// Value is the fixed value used by AttrConstant.
+	Value string `json:"value,omitempty"`
+
+	// Values is the source-to-target lookup table used by AttrMap.
+	Values map[string]string `json:"values,omitempty"`
+
+	// ValuesFile is a two-column CSV merged into Values, relative to the config file.
+	ValuesFile string `json:"values_file,omitempty"`
+
+	// Unmapped replaces values missing from Values; empty exports them as they are.
+	Unmapped string `json:"unmapped,omitempty"`
+
+	// folded indexes Values by lower case, for values differing from the table only by case.
+	folded map[string]string
+}
+
+// CoreField is a product field outside of attributes that can be translated.
+type CoreField string
+
+const (
+	// FieldTitle is the product title, exported as 'Auction Title'.
+	FieldTitle CoreField = "Title"
+
+	// FieldDescription is the (possibly HTML) product description.
+	FieldDescription CoreField = "Description"
+
+	// FieldClassification is the ChannelAdvisor classification.
+	FieldClassification CoreField = "Classification"
+)
+
+// AttrPolicies holds every attribute policy for a region.
+type AttrPolicies struct {
+	// Default applies to attributes not listed in Attrs.
+	Default AttrPolicy            `json:"default"`
+	Attrs   map[string]AttrPolicy `json:"attributes"`
+
+	// Fields are the core product fields translated along with attributes; none by default.
+	Fields []CoreField `json:"fields,omitempty"`
+}
+
+// DefaultAttrPolicies builds policies matching FilterAttr.
+func DefaultAttrPolicies() AttrPolicies {
+	ap := AttrPolicies{
+		Default: AttrPolicy{Action: AttrDrop},
+		Attrs:   map[string]AttrPolicy{},
+	}
+	for name, tlate := range FilterAttr {
+		act := AttrExport
+		if tlate {
+			act = AttrTranslate
+		}
+		ap.Attrs[name] = AttrPolicy{Action: act}
+	}
+	return ap
+}
+
+// LoadAttrPolicies reads region attribute policies from a JSON config file.
+func LoadAttrPolicies(fnm string) (AttrPolicies, error) {
+	ap := AttrPolicies{}
+
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return ap, err
+	}
+	err = json.Unmarshal(b, &ap)
+	if err != nil {
+		return ap, err
+	}
+
+	return ap, ap.resolve(filepath.Dir(fnm))
+}
+
+// resolve finishes policies read from config: defaulting the action, merging values files
+// relative to dir, validating and indexing lookup tables.
+func (ap *AttrPolicies) resolve(dir string) error {
+	if len(ap.Default.Action) == 0 {
+		ap.Default.Action = AttrDrop
+	}
+
+	for name, pol := range ap.Attrs {
+		if len(pol.ValuesFile) == 0 {
+			continue
+		}
+		vfnm := pol.ValuesFile
+		if !filepath.IsAbs(vfnm) {
+			vfnm = filepath.Join(dir, vfnm)
+		}
+		vals, err := loadValueMap(vfnm)
+		if err != nil {
+			return err
+		}
+		if pol.Values == nil {
+			pol.Values = map[string]string{}
+		}
+		for src, dst := range vals {
+			if _, exists := pol.Values[src]; !exists {
+				pol.Values[src] = dst
+			}
+		}
+		ap.Attrs[name] = pol
+	}
+
+	err := ap.validate()
+	if err != nil {
+		return err
+	}
+	ap.index()
+
+	return nil
+}
+
+// loadValueMap reads a 'source,target' CSV lookup table.
+func loadValueMap(fnm string) (map[string]string, error) {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	recs, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := map[string]string{}
+	for _, rec := range recs {
+		vals[rec[0]] = rec[1]
+	}
+	return vals, nil
+}
+
+func (ap AttrPolicies) validate() error {
+	pols := append([]AttrPolicy{ap.Default}, ap.values()...)
+	for _, pol := range pols {
+		switch pol.Action {
+		case AttrDrop, AttrExport, AttrTranslate, AttrConstant:
+		case AttrMap:
+			if len(pol.Values) == 0 {
+				return errors.New("empty lookup table for attribute action 'map'")
+			}
+			folded := map[string]string{}
+			for src, dst := range pol.Values {
+				key := strings.ToLower(src)
+				if old, exists := folded[key]; exists && old != dst {
+					return errors.New("lookup table maps '" + src + "' differently by case alone")
+				}
+				folded[key] = dst
+			}
+		default:
+			return errors.New("unknown attribute action '" + string(pol.Action) + "'")
+		}
+	}
+	for _, f := range ap.Fields {
+		switch f {
+		case FieldTitle, FieldDescription, FieldClassification:
+		default:
+			return errors.New("unknown core field '" + string(f) + "'")
+		}
+	}
+	return nil
+}
+
+// index builds the case-insensitive lookup of every AttrMap policy.
+func (ap AttrPolicies) index() {
+	for name, pol := range ap.Attrs {
+		if pol.Action != AttrMap {
+			continue
+		}
+		pol.folded = foldValues(pol.Values)
+		ap.Attrs[name] = pol
+	}
+}
+
+// foldValues indexes a lookup table by lower case, the first source in sorted order winning.
+func foldValues(vals map[string]string) map[string]string {
+	folded := map[string]string{}
+	for _, src := range sortedKeys(vals) {
+		key := strings.ToLower(src)
+		if _, exists := folded[key]; !exists {
+			folded[key] = vals[src]
+		}
+	}
+	return folded
+}
+
+// exportNames gives the sorted names every listed, non-dropped attribute is exported under.
+func (ap AttrPolicies) exportNames() []string {
+	names := map[string]bool{}
+	for name, pol := range ap.Attrs {
+		if pol.Action == AttrDrop {
+			continue
+		}
+		if len(pol.Rename) > 0 {
+			name = pol.Rename
+		}
+		names[name] = true
+	}
+	return sortedKeys(names)
+}
+
+func (ap AttrPolicies) values() []AttrPolicy {
+	pols := []AttrPolicy{}
+	for _, pol := range ap.Attrs {
+		pols = append(pols, pol)
+	}
+	return pols
+}
+
+// get gives the policy for an attribute, falling back to the default.
+func (ap AttrPolicies) get(name string) AttrPolicy {
+	pol, exists := ap.Attrs[name]
+	if !exists {
+		return ap.Default
+	}
+	return pol
+}
+
+// translates reports whether an attribute value should go through the Dictionary.
+func (ap AttrPolicies) translates(name string) bool {
+	return ap.get(name).Action == AttrTranslate
+}
+
+// apply runs a product's attributes through the policies, giving what gets exported
+// along with the source attributes whose values were missing from their lookup table.
+func (ap AttrPolicies) apply(attrs []chapi.AttributeValue) ([]attrkv, []attrkv) {
+	kvs := []attrkv{}
+	unmapped := []attrkv{}
+	seen := map[string]bool{}
+	for _, attr := range attrs {
+		seen[attr.Name] = true
+
+		pol := ap.get(attr.Name)
+		if pol.Action == AttrDrop {
+			continue
+		}
+		kv, mapped := pol.export(attr.Name, attr.Value)
+		if !mapped {
+			unmapped = append(unmapped, attrkv{attr.Name, attr.Value})
+		}
+		kvs = append(kvs, kv)
+	}
+
+	// constants show up even when the product never carried the attribute
+	names := []string{}
+	for name, pol := range ap.Attrs {
+		if pol.Action == AttrConstant && !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		kv, _ := ap.Attrs[name].export(name, "")
+		kvs = append(kvs, kv)
+	}
+
+	return kvs, unmapped
+}
+
+// export gives an attribute as exported, reporting false when AttrMap had no mapping for its value.
+func (pol AttrPolicy) export(name, value string) (attrkv, bool) {
+	mapped := true
+	switch pol.Action {
+	case AttrConstant:
+		value = pol.Value
+	case AttrMap:
+		value, mapped = pol.lookup(value)
+	}
+	if len(pol.Rename) > 0 {
+		name = pol.Rename
+	}
+	return attrkv{name, value}, mapped
+}
+
+// lookup maps a controlled-vocabulary value, ignoring case when there is no exact match.
+// Unknown values become Unmapped when set and are otherwise left untouched; either way it reports false.
+func (pol AttrPolicy) lookup(value string) (string, bool) {
+	if mapped, exists := pol.Values[value]; exists {
+		return mapped, true
+	}
+	folded := pol.folded
+	if folded == nil {
+		folded = foldValues(pol.Values)
+	}
+	if mapped, exists := folded[strings.ToLower(value)]; exists {
+		return mapped, true
+	}
+	if len(pol.Unmapped) > 0 {
+		return pol.Unmapped, false
+	}
+	return value, false
+}
+
+// attrPolicies gives the region's attribute policies, defaulting to FilterAttr.
+func (r Region) attrPolicies() AttrPolicies {
+	if r.Attrs == nil {
+		return DefaultAttrPolicies()
+	}
+	return *r.Attrs
+}
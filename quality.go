@@ -0,0 +1,221 @@
+package transku
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// QualityIssue names something wrong with a machine translation.
+type QualityIssue string
+
+const (
+	// SameAsSource is a translation identical to its source.
+	SameAsSource QualityIssue = "same as source"
+
+	// EmptyResult is a translation with nothing in it.
+	EmptyResult QualityIssue = "empty result"
+
+	// LengthRatio is a translation far longer or shorter than its source.
+	LengthRatio QualityIssue = "length ratio"
+
+	// EnglishLeft is a translation still carrying English words from its source.
+	EnglishLeft QualityIssue = "untranslated english"
+
+	// LostNumbers is a translation missing numbers (or units) from its source text.
+	// Numbers held as placeholders are left to ChangedPlaceholders.
+	LostNumbers QualityIssue = "lost numbers"
+
+	// ChangedPlaceholders is a translation that does not keep every placeholder of its source exactly once.
+	ChangedPlaceholders QualityIssue = "changed placeholders"
+
+	// Profanity is a translation containing a blocked word.
+	Profanity QualityIssue = "profanity"
+)
+
+// QualityCheck decides which machine translations are quarantined for review.
+type QualityCheck struct {
+	// MaxLengthRatio flags translations over this many times longer (or shorter) than the source; zero disables it.
+	MaxLengthRatio float64 `json:"max_length_ratio"`
+
+	// MinRatioLength is the shortest source checked by MaxLengthRatio, since short phrases swing wildly.
+	MinRatioLength int `json:"min_ratio_length"`
+
+	// EnglishWords are words that should never survive translation.
+	EnglishWords []string `json:"english_words"`
+
+	// Profanity are words never allowed in a translation.
+	Profanity []string `json:"profanity"`
+
+	// Skip turns off individual checks.
+	Skip []QualityIssue `json:"skip"`
+}
+
+// DefaultQualityCheck is used by regions without a QualityCheck of their own.
+//
+// SameAsSource is skipped, since loanwords, model names and sizes ('Jeans', 'T-Shirt', 'XL')
+// rightly translate to themselves; English the translator missed is still caught by EnglishLeft.
+var DefaultQualityCheck = QualityCheck{
+	MaxLengthRatio: 3,
+	MinRatioLength: 12,
+	EnglishWords: []string{
+		"the", "and", "with", "from", "men's", "women's", "boys", "girls", "kids",
+	},
+	Profanity: DefaultProfanity,
+	Skip:      []QualityIssue{SameAsSource},
+}
+
+// DefaultProfanity blocks common profanity in English and the region languages sold to.
+var DefaultProfanity = []string{
+	// English
+	"fuck", "fucking", "shit", "bitch", "cunt", "asshole", "whore", "slut",
+	// German
+	"scheiße", "scheisse", "arschloch", "fotze", "hure", "wichser",
+	// French
+	"merde", "putain", "connard", "salope", "enculé",
+	// Spanish
+	"mierda", "puta", "coño", "cabrón", "gilipollas",
+	// Italian
+	"cazzo", "stronzo", "puttana", "vaffanculo",
+}
+
+var numberRegex = regexp.MustCompile(`\d+(?:[.,]\d+)*`)
+
+// LoadQualityCheck reads a region's quality check from a JSON config file.
+func LoadQualityCheck(fnm string) (QualityCheck, error) {
+	qc := QualityCheck{}
+
+	b, err := os.ReadFile(fnm)
+	if err != nil {
+		return qc, err
+	}
+	err = json.Unmarshal(b, &qc)
+	return qc, err
+}
+
+// Quarantined is a machine translation held back for review.
+type Quarantined struct {
+	Translation string         `json:"translation"`
+	Issues      []QualityIssue `json:"issues"`
+}
+
+// Check gives every issue found with a translation of src.
+func (qc QualityCheck) Check(src, tlate string) []QualityIssue {
+	issues := []QualityIssue{}
+	flag := func(qi QualityIssue) {
+		for _, skip := range qc.Skip {
+			if skip == qi {
+				return
+			}
+		}
+		issues = append(issues, qi)
+	}
+
+	if len(strings.TrimSpace(tlate)) == 0 {
+		flag(EmptyResult)
+		return issues
+	}
+	if tlate == src {
+		flag(SameAsSource)
+	}
+
+	srcLen, tlateLen := len([]rune(src)), len([]rune(tlate))
+	if qc.MaxLengthRatio > 0 && srcLen >= qc.MinRatioLength {
+		ratio := float64(tlateLen) / float64(srcLen)
+		if ratio > qc.MaxLengthRatio || ratio < 1/qc.MaxLengthRatio {
+			flag(LengthRatio)
+		}
+	}
+
+	// placeholders are checked on their own, so words and numbers are only looked for around them
+	srcText, tlateText := placeholderRegex.ReplaceAllString(src, " "), placeholderRegex.ReplaceAllString(tlate, " ")
+
+	if tlate != src {
+		srcWords, tlateWords := wordSet(srcText), wordSet(tlateText)
+		for _, w := range qc.EnglishWords {
+			w = strings.ToLower(w)
+			if srcWords[w] && tlateWords[w] {
+				flag(EnglishLeft)
+				break
+			}
+		}
+	}
+
+	tlateNums := map[string]int{}
+	for _, n := range numberRegex.FindAllString(tlateText, -1) {
+		tlateNums[digitsOnly(n)]++
+	}
+	for _, n := range numberRegex.FindAllString(srcText, -1) {
+		d := digitsOnly(n)
+		if tlateNums[d] == 0 {
+			flag(LostNumbers)
+			break
+		}
+		tlateNums[d]--
+	}
+
+	if src != tlate {
+		if _, err := (segment{held: heldIn(src)}).restore(tlate); err != nil {
+			flag(ChangedPlaceholders)
+		}
+	}
+
+	tlateWords := wordSet(tlateText)
+	for _, w := range qc.Profanity {
+		if tlateWords[strings.ToLower(w)] {
+			flag(Profanity)
+			break
+		}
+	}
+
+	return issues
+}
+
+// heldIn gives every placeholder in a segment, as restored by itself.
+func heldIn(text string) map[string]string {
+	held := map[string]string{}
+	for _, ph := range placeholderRegex.FindAllString(text, -1) {
+		held[ph] = ph
+	}
+	return held
+}
+
+func wordSet(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+func digitsOnly(n string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, n)
+}
+
+// Quarantine gives every machine translation held back for review, keyed by source phrase.
+func (dict *Dictionary) Quarantine() map[string]Quarantined {
+	q := map[string]Quarantined{}
+	dict.cache.each(func(src string, e entry) {
+		if e.rv.State == ReviewPending && len(e.rv.Issues) > 0 {
+			q[src] = Quarantined{e.rv.Machine, e.rv.Issues}
+		}
+	})
+	return q
+}
+
+// qualityCheck gives the region's quality check, defaulting to DefaultQualityCheck.
+func (r Region) qualityCheck() QualityCheck {
+	if r.Quality == nil {
+		return DefaultQualityCheck
+	}
+	return *r.Quality
+}
@@ -0,0 +1,44 @@
+package transku
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQualityCheck(t *testing.T) {
+	all := DefaultQualityCheck
+	all.Skip = nil
+
+	for _, tc := range []struct {
+		name  string
+		qc    QualityCheck
+		src   string
+		tlate string
+		want  []QualityIssue
+	}{
+		{"clean", all, "Soft cotton shirt", "Weiches Baumwollhemd", []QualityIssue{}},
+		{"empty", all, "Soft cotton shirt", "  ", []QualityIssue{EmptyResult}},
+		{"same as source", all, "Jeans", "Jeans", []QualityIssue{SameAsSource}},
+		{"same as source skipped", DefaultQualityCheck, "Jeans", "Jeans", []QualityIssue{}},
+		{"too long", all, "Machine washable", "Waschbar in der Waschmaschine bei niedriger Temperatur und kurz", []QualityIssue{LengthRatio}},
+		{"too short", all, "Machine washable shirt", "Hemd", []QualityIssue{LengthRatio}},
+		{"short source unchecked", all, "Shirt", "Ein sehr langes Oberhemd", []QualityIssue{}},
+		{"english left", all, "Shirt with pocket", "Hemd with Tasche", []QualityIssue{EnglishLeft}},
+		{"lost number", all, "Pack of 3 socks", "Packung Socken", []QualityIssue{LostNumbers}},
+		{"kept number", all, "Pack of 3 socks", "Packung mit 3 Socken", []QualityIssue{}},
+		{"placeholders kept", all, "Pack of ⟦n1⟧ socks", "Packung mit ⟦n1⟧ Socken", []QualityIssue{}},
+		{"placeholders reordered", all, "⟦b1⟧ shirt, ⟦n1⟧ pack", "⟦n1⟧er-Pack ⟦b1⟧ Hemd", []QualityIssue{}},
+		{"placeholder dropped", all, "Pack of ⟦n1⟧ socks", "Paquete de calcetines", []QualityIssue{ChangedPlaceholders}},
+		{"placeholder duplicated", all, "Pack of ⟦n1⟧ socks", "⟦n1⟧ Packung mit ⟦n1⟧ Socken", []QualityIssue{ChangedPlaceholders}},
+		{"placeholder mangled", all, "Pack of ⟦n1⟧ socks", "Packung mit ⟦N1⟧ Socken", []QualityIssue{ChangedPlaceholders}},
+		{"profanity", all, "Great shirt", "Scheiße Hemd", []QualityIssue{Profanity}},
+		{"skipped", QualityCheck{Skip: []QualityIssue{Profanity}, Profanity: []string{"hure"}}, "Shirt", "Hure", []QualityIssue{}},
+		{"several", all, "Pack of 3 socks with the shirt", "Pack the", []QualityIssue{LengthRatio, EnglishLeft, LostNumbers}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.qc.Check(tc.src, tc.tlate); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("issues %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,20 +3,21 @@ package transku
 import "regexp"
 
 const (
-	// HTMLPattern catches anything in HTML brackets.
-	HTMLPattern = `<[^<>]*>`
+	// HTMLPattern catches HTML tags and character entities, telling HTML apart from plain text.
+	HTMLPattern = `</?[A-Za-z!][^<>]*>|&(?:#[0-9]+|#[xX][0-9A-Fa-f]+|[A-Za-z][A-Za-z0-9]*);`
 
 	// WordPattern catches alphabetical words in english.
+	//
+	// Deprecated: text is split into segments by BoundaryPattern and InlinePattern instead.
 	WordPattern = `[A-Za-z'][A-Za-z'-]*[A-Za-z']{2,}|[AEIOUaeiou]|[A-Za-z']{2,}`
 
 	// PhrasePattern catches phrases at a time.
+	//
+	// Deprecated: text is split into segments by BoundaryPattern and InlinePattern instead.
 	PhrasePattern = `(` + WordPattern + `)` + `( (` + WordPattern + `))*`
 )
 
 var (
 	// HTML is the regular expression compiled.
 	htmlRegex = regexp.MustCompile(HTMLPattern)
-
-	// Phrase is the regular expression compiled.
-	phraseRegex = regexp.MustCompile(PhrasePattern)
 )
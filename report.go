@@ -0,0 +1,227 @@
+package transku
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StageTiming is how long a single pipeline stage took.
+type StageTiming struct {
+	Stage   string  `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Report describes everything a region run did.
+type Report struct {
+	Run          string                 `json:"run"`
+	Region       string                 `json:"region"`
+	Started      time.Time              `json:"started"`
+	Stages       []StageTiming          `json:"stages"`
+	DictBefore   int                    `json:"dictionary_before"`
+	DictAfter    int                    `json:"dictionary_after"`
+	NewPhrases   map[string]string      `json:"new_phrases"`
+	Quarantined  map[string]Quarantined `json:"quarantined"`
+	Cost         string                 `json:"cost"`
+	Warnings     []string               `json:"warnings"`
+	Skipped      []string               `json:"skipped"`
+	Blocked      map[string][]string    `json:"blocked_on_review"`
+	Missing      []MissingEntry         `json:"missing"`
+	RowsUploaded int                    `json:"rows_uploaded"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+var reportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>transKU {{.Region}} {{.Run}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>transKU {{.Region}}</h1>
+<p>Run {{.Run}}, started {{.Started.Format "2006-01-02 15:04:05 MST"}}</p>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<table>
+<tr><th>Dictionary before</th><td>{{.DictBefore}}</td></tr>
+<tr><th>Dictionary after</th><td>{{.DictAfter}}</td></tr>
+<tr><th>Cost</th><td>{{.Cost}}</td></tr>
+<tr><th>Rows uploaded</th><td>{{.RowsUploaded}}</td></tr>
+</table>
+<h2>Stages</h2>
+<table>
+<tr><th>Stage</th><th>Seconds</th></tr>
+{{range .Stages}}<tr><td>{{.Stage}}</td><td>{{printf "%.1f" .Seconds}}</td></tr>
+{{end}}</table>
+<h2>Warnings ({{len .Warnings}})</h2>
+<ul>
+{{range .Warnings}}<li>{{.}}</li>
+{{end}}</ul>
+<h2>Skipped products ({{len .Skipped}})</h2>
+<ul>
+{{range .Skipped}}<li>{{.}}</li>
+{{end}}</ul>
+<h2>Blocked on review ({{len .Blocked}})</h2>
+<table>
+<tr><th>SKU</th><th>Phrases</th></tr>
+{{range $sku, $phrases := .Blocked}}<tr><td>{{$sku}}</td><td>{{range $phrases}}{{.}}; {{end}}</td></tr>
+{{end}}</table>
+<h2>Missing from Dictionary ({{len .Missing}})</h2>
+<table>
+<tr><th>SKU</th><th>Field</th><th>Segment</th><th>Empty</th></tr>
+{{range .Missing}}<tr><td>{{.SKU}}</td><td>{{.Field}}</td><td>{{.Segment}}</td><td>{{if .Empty}}yes{{end}}</td></tr>
+{{end}}</table>
+<h2>Quarantined translations ({{len .Quarantined}})</h2>
+<table>
+<tr><th>Source</th><th>Translation</th><th>Issues</th></tr>
+{{range $src, $q := .Quarantined}}<tr><td>{{$src}}</td><td>{{$q.Translation}}</td><td>{{range $q.Issues}}{{.}}; {{end}}</td></tr>
+{{end}}</table>
+<h2>New phrases ({{len .NewPhrases}})</h2>
+<table>
+<tr><th>Source</th><th>Translation</th></tr>
+{{range $src, $tlate := .NewPhrases}}<tr><td>{{$src}}</td><td>{{$tlate}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// timed runs a stage, adding how long it took to the report.
+func (rep *Report) timed(stage string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	rep.Stages = append(rep.Stages, StageTiming{stage, time.Since(start).Seconds()})
+	return err
+}
+
+// Save writes the report as 'report.json' and 'report.html' into dir.
+func (rep Report) Save(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(rep, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, "report.json"), b, 0644)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "report.html"))
+	if err != nil {
+		return err
+	}
+	err = reportTmpl.Execute(f, rep)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RunRegion creates, applies and uploads a region's translations, giving a report of the run.
+// The report is saved next to the region's other outputs, even when the run fails.
+// Regions with a Batch stream their products through translation and upload; see Region.Batch.
+func (t TransKU) RunRegion(r Region) (Report, error) {
+	rep := Report{
+		Run:        t.run,
+		Region:     strings.ToUpper(r.ChannelTag),
+		Started:    time.Now(),
+		NewPhrases: map[string]string{},
+		Warnings:   []string{},
+		Skipped:    []string{},
+	}
+	uploaded := t.metrics.Counter(MetricRowsUploaded, rep.Region)
+
+	err := t.runRegion(r, &rep)
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	rep.RowsUploaded = int(t.metrics.Counter(MetricRowsUploaded, rep.Region) - uploaded)
+
+	dir := filepath.Dir(t.runPath(r, "report.json"))
+	if len(t.runDir) == 0 {
+		dir = strings.ToLower(r.ChannelTag) + "-report"
+	}
+	serr := rep.Save(dir)
+	if serr != nil {
+		t.regionLogger(r).Error("saving report", "err", serr)
+	}
+
+	return rep, err
+}
+
+func (t TransKU) runRegion(r Region, rep *Report) error {
+	var dict *Dictionary
+	err := rep.timed("create dictionary", func() error {
+		var err error
+		dict, err = t.CreateDict(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	rep.DictBefore = dict.loaded
+
+	// apply and stream can still add phrases under TranslateMissing, so the Dictionary is read once they finish
+	defer func() {
+		rep.DictAfter = dict.cache.len()
+		rep.Cost = fmt.Sprint(dict.GetPrice())
+		rep.NewPhrases = dict.newPhrases()
+		rep.Quarantined = dict.Quarantine()
+	}()
+
+	if r.Batch > 0 {
+		rep.Blocked, rep.Missing = map[string][]string{}, []MissingEntry{}
+		return rep.timed("stream", func() error {
+			return t.streamDict(dict, r, rep)
+		})
+	}
+
+	var ip IntlProds
+	err = rep.timed("apply dictionary", func() error {
+		var err error
+		ip, err = t.ApplyDict(dict, r)
+		return err
+	})
+	rep.Blocked, rep.Missing = ip.trans.Blocked, ip.trans.Missing
+	if err != nil {
+		return err
+	}
+	for _, fi := range ip.families.Issues {
+		rep.Warnings = append(rep.Warnings, fi.String())
+	}
+	rep.Skipped = append(rep.Skipped, ip.skipped...)
+
+	return rep.timed("upload", func() error {
+		return t.WriteChannelAdvisor(ip)
+	})
+}
+
+// skippedSKUs gives the sorted SKUs present in ip but missing from kept.
+func skippedSKUs(ip, kept IntlProds) []string {
+	left := map[string]bool{}
+	for _, pre := range kept.pres {
+		left[pre.InventoryNumber] = true
+	}
+	skus := []string{}
+	for _, pre := range ip.pres {
+		if !left[pre.InventoryNumber] {
+			skus = append(skus, pre.InventoryNumber)
+		}
+	}
+	sort.Strings(skus)
+	return skus
+}
@@ -0,0 +1,214 @@
+package transku
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// ReviewState is how far a Dictionary entry has come through human review.
+type ReviewState string
+
+const (
+	// ReviewMachine is machine output nobody has looked at.
+	ReviewMachine ReviewState = "machine"
+
+	// ReviewPending is an entry waiting on a reviewer, such as a quarantined translation.
+	ReviewPending ReviewState = "pending"
+
+	// ReviewApproved is an entry a reviewer signed off on.
+	ReviewApproved ReviewState = "approved"
+
+	// ReviewRejected is an entry a reviewer turned down.
+	ReviewRejected ReviewState = "rejected"
+)
+
+// Review is the review history of a single Dictionary entry.
+// Entries without one predate reviews and count as approved.
+type Review struct {
+	State   ReviewState
+	Machine string
+	Issues  []QualityIssue
+	Editor  string
+	Updated time.Time
+}
+
+type reviewBook map[string]Review
+
+// ReviewPolicy decides what a region does with entries that are not approved.
+type ReviewPolicy int
+
+const (
+	// UseMachine uses unreviewed machine output, falling back to English for pending or rejected entries.
+	UseMachine ReviewPolicy = iota
+
+	// FallbackEnglish only uses approved entries, leaving everything else in English.
+	FallbackEnglish
+
+	// HoldProduct keeps products with any unapproved entry from being translated at all.
+	HoldProduct
+)
+
+var reviewHeader = []string{"Source", "Translation", "State", "Machine", "Issues"}
+
+// usable reports whether an entry's translation may go out under the region's policy.
+func (dict *Dictionary) usable(e entry) bool {
+	switch e.state() {
+	case ReviewApproved:
+		return true
+	case ReviewMachine:
+		return dict.policy == UseMachine
+	}
+	return false
+}
+
+// blockedBy gives every phrase holding a product back, when the region holds products.
+func (dict *Dictionary) blockedBy(m masked) []string {
+	if dict.policy != HoldProduct {
+		return nil
+	}
+	return dict.unapproved(m)
+}
+
+// unapproved gives every phrase in masked text whose entry is not approved.
+func (dict *Dictionary) unapproved(m masked) []string {
+	phrases := []string{}
+	for _, seg := range m.segs {
+		e, exists := dict.cache.get(seg.text)
+		if exists && e.state() != ReviewApproved {
+			phrases = append(phrases, seg.text)
+		}
+	}
+	return phrases
+}
+
+// BlockedSKUs gives every product read from ChannelAdvisor that HoldProduct would hold back,
+// with the phrases awaiting review, whatever the region's policy. Unlike TransResult, it needs no GoTransAll run.
+func (t TransKU) BlockedSKUs(dict *Dictionary) map[string][]string {
+	return dict.blockedSKUs(t.prods)
+}
+
+func (dict *Dictionary) blockedSKUs(prods []chapi.Product) map[string][]string {
+	blocked := map[string][]string{}
+	for _, prod := range prods {
+		phrases := map[string]bool{}
+		fields, _, titles := dict.filter(&prod)
+		for i := range fields {
+			head, tail := getChildTitleSize(prod, fields, i, titles)
+			for _, text := range []string{head, tail} {
+				for _, phrase := range dict.unapproved(strip(text, prod)) {
+					phrases[phrase] = true
+				}
+			}
+		}
+		if len(phrases) > 0 {
+			blocked[prod.Sku] = sortedKeys(phrases)
+		}
+	}
+	holdFamilies(prods, blocked)
+	return blocked
+}
+
+// ExportPending writes every entry awaiting review as CSV, for translators to fill in.
+// Machine entries are included too when the region does not use them unreviewed.
+func (dict *Dictionary) ExportPending(w io.Writer) error {
+	pending := map[string]entry{}
+	dict.cache.each(func(phrase string, e entry) {
+		if e.rv.State == ReviewPending || (e.rv.State == ReviewMachine && dict.policy != UseMachine) {
+			pending[phrase] = e
+		}
+	})
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(reviewHeader)
+	if err != nil {
+		return err
+	}
+	for _, phrase := range sortedKeys(pending) {
+		e := pending[phrase]
+		issues := []string{}
+		for _, qi := range e.rv.Issues {
+			issues = append(issues, string(qi))
+		}
+		err = cw.Write([]string{phrase, e.tlate, string(e.rv.State), e.rv.Machine, strings.Join(issues, "; ")})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ImportReviewed reads reviewed entries back from CSV written by ExportPending.
+// Rows whose state is 'approved' or 'rejected' are applied; anything else is left alone.
+func (dict *Dictionary) ImportReviewed(r io.Reader, editor string) (int, error) {
+	recs, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(recs) == 0 {
+		return 0, errors.New("empty review file")
+	}
+
+	cols := map[string]int{}
+	for i, name := range recs[0] {
+		cols[name] = i
+	}
+	for _, name := range reviewHeader[:3] {
+		if _, exists := cols[name]; !exists {
+			return 0, errors.New("missing column '" + name + "'")
+		}
+	}
+
+	n := 0
+	for _, rec := range recs[1:] {
+		src, tlate := rec[cols["Source"]], rec[cols["Translation"]]
+		st := ReviewState(strings.ToLower(strings.TrimSpace(rec[cols["State"]])))
+		if st != ReviewApproved && st != ReviewRejected {
+			continue
+		}
+		err = dict.SetEntry(src, tlate, st, editor)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// SetEntry records a reviewer's decision on an entry, along with their translation.
+// Reviewers may only approve, reject or leave an entry pending.
+func (dict *Dictionary) SetEntry(src, tlate string, st ReviewState, editor string) error {
+	switch st {
+	case ReviewApproved, ReviewRejected, ReviewPending:
+	default:
+		return errors.New("unknown review state '" + string(st) + "' for '" + src + "'")
+	}
+	if st == ReviewApproved && len(tlate) == 0 {
+		return errors.New("approving an empty translation for '" + src + "'")
+	}
+
+	exists, err := dict.cache.update(src, func(e entry) (entry, error) {
+		if len(e.rv.Machine) == 0 {
+			e.rv.Machine = e.tlate
+		}
+		e.rv.State = st
+		e.rv.Editor = editor
+		e.rv.Updated = time.Now()
+
+		if len(tlate) > 0 {
+			e.tlate = tlate
+		}
+		return e, nil
+	})
+	if !exists {
+		return errors.New("no Dictionary entry for '" + src + "'")
+	}
+	return err
+}
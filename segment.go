@@ -0,0 +1,200 @@
+package transku
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// BoundaryPattern catches where a sentence or clause ends: line breaks, sentence punctuation and clause separators.
+	BoundaryPattern = `\r?\n|[.!?]+(?:[\s\p{Z}]+|$)|[\s\p{Z}]*[;:|•·][\s\p{Z}]*|[\s\p{Z}]+[-–—][\s\p{Z}]+`
+
+	// InlinePattern catches numbers, codes and units, as well as symbols, which are held out of translation.
+	// Placeholder brackets already in the text are caught too, so they never collide with real placeholders.
+	InlinePattern = `[\p{L}\p{Nd}]*\p{Nd}(?:[\p{L}\p{Nd}]|[.,]\p{Nd})*(?:\s(?:cm|mm|oz|lbs?|kg|ml|ft|inch(?:es)?)\b|%|"|°)?|\p{S}+|[⟦⟧]`
+
+	// PlaceholderPattern catches placeholders such as '⟦b1⟧', a kind letter followed by an index.
+	PlaceholderPattern = `⟦[a-z][0-9]+⟧`
+)
+
+const (
+	heldBrand  = 'b'
+	heldInline = 'n'
+)
+
+var (
+	boundaryRegex    = regexp.MustCompile(BoundaryPattern)
+	inlineRegex      = regexp.MustCompile(InlinePattern)
+	placeholderRegex = regexp.MustCompile(PlaceholderPattern)
+)
+
+// segment is a sentence or clause translated as a whole.
+type segment struct {
+	// text is what the Dictionary and translator see, with held pieces as placeholders.
+	text string
+	held map[string]string
+
+	// esc re-encodes the segment for where it came from, such as an HTML text node.
+	esc *strings.Replacer
+}
+
+// masked is text split into literal pieces around the segments to translate.
+type masked struct {
+	// lits always holds one more piece than segs, starting and ending the text.
+	lits []string
+	segs []segment
+}
+
+// mask splits text into sentence and clause segments, holding the brand, numbers and symbols inside them out.
+// Anything between segments, such as punctuation and lone numbers, is kept as is.
+// Text with HTML in it is tokenized, so only its text and HTMLAttrs are segmented.
+func mask(text, brand string) masked {
+	m := masked{lits: []string{""}}
+	if htmlRegex.MatchString(text) {
+		m.addHTML(text, brand)
+	} else {
+		m.addText(text, brand, nil)
+	}
+	return m
+}
+
+// lit adds literal text, kept as is.
+func (m *masked) lit(s string) {
+	m.lits[len(m.lits)-1] += s
+}
+
+// addText segments plain text, re-encoding everything with esc when set.
+func (m *masked) addText(text, brand string, esc *strings.Replacer) {
+	encode := func(s string) string {
+		if esc == nil {
+			return s
+		}
+		return esc.Replace(s)
+	}
+
+	last := 0
+	bounds := append(boundaryRegex.FindAllStringIndex(text, -1), []int{len(text), len(text)})
+	for _, b := range bounds {
+		clause := text[last:b[0]]
+		start, end, seg, ok := segmentClause(clause, brand)
+		if ok {
+			seg.esc = esc
+			m.lit(encode(clause[:start]))
+			m.segs = append(m.segs, seg)
+			m.lits = append(m.lits, encode(clause[end:]))
+		} else {
+			m.lit(encode(clause))
+		}
+		m.lit(encode(text[b[0]:b[1]]))
+		last = b[1]
+	}
+}
+
+// join puts masked text back together, with each segment swapped by fn.
+func (m masked) join(fn func(segment) string) string {
+	b := strings.Builder{}
+	for i, seg := range m.segs {
+		b.WriteString(m.lits[i])
+		out := fn(seg)
+		if seg.esc != nil {
+			out = seg.esc.Replace(out)
+		}
+		b.WriteString(out)
+	}
+	b.WriteString(m.lits[len(m.lits)-1])
+	return b.String()
+}
+
+// segmentClause finds the span of a clause worth translating, reporting false when there is none.
+func segmentClause(clause, brand string) (int, int, segment, bool) {
+	start := strings.IndexFunc(clause, isWordRune)
+	if start == -1 {
+		return 0, 0, segment{}, false
+	}
+	end := strings.LastIndexFunc(clause, isWordRune)
+	_, size := utf8.DecodeRuneInString(clause[end:])
+	end += size
+
+	// keep a parenthetical whole when it closes the clause
+	for end < len(clause) && clause[end] == ')' && strings.Count(clause[start:end], "(") > strings.Count(clause[start:end], ")") {
+		end++
+	}
+
+	seg := hold(clause[start:end], brand)
+	if strings.IndexFunc(placeholderRegex.ReplaceAllString(seg.text, ""), unicode.IsLetter) == -1 {
+		return 0, 0, segment{}, false
+	}
+	return start, end, seg, true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
+
+// hold swaps the brand, numbers, units and symbols for indexed placeholders.
+func hold(text, brand string) segment {
+	seg := segment{held: map[string]string{}}
+	b := strings.Builder{}
+	cnt := map[byte]int{}
+	put := func(kind byte, s string) {
+		cnt[kind]++
+		ph := "⟦" + string(kind) + strconv.Itoa(cnt[kind]) + "⟧"
+		seg.held[ph] = s
+		b.WriteString(ph)
+	}
+
+	for len(text) > 0 {
+		bi := -1
+		if len(brand) > 0 {
+			bi = strings.Index(text, brand)
+		}
+		loc := inlineRegex.FindStringIndex(text)
+
+		switch {
+		case bi != -1 && (loc == nil || bi <= loc[0]):
+			b.WriteString(text[:bi])
+			put(heldBrand, brand)
+			text = text[bi+len(brand):]
+		case loc != nil:
+			b.WriteString(text[:loc[0]])
+			put(heldInline, text[loc[0]:loc[1]])
+			text = text[loc[1]:]
+		default:
+			b.WriteString(text)
+			text = ""
+		}
+	}
+
+	seg.text = b.String()
+	return seg
+}
+
+// restore puts held pieces back into a translation of the segment.
+// Every placeholder has to come back exactly once, with nothing unknown or mangled left over.
+func (seg segment) restore(tlate string) (string, error) {
+	if strings.ContainsAny(placeholderRegex.ReplaceAllString(tlate, ""), "⟦⟧") {
+		return "", errors.New("mangled placeholder in '" + tlate + "'")
+	}
+
+	used := map[string]int{}
+	out := placeholderRegex.ReplaceAllStringFunc(tlate, func(ph string) string {
+		used[ph]++
+		return seg.held[ph]
+	})
+	for ph := range used {
+		if _, exists := seg.held[ph]; !exists {
+			return "", errors.New("unknown placeholder '" + ph + "' in '" + tlate + "'")
+		}
+	}
+	for ph := range seg.held {
+		if used[ph] != 1 {
+			return "", errors.New("placeholder '" + ph + "' used " + strconv.Itoa(used[ph]) + " times in '" + tlate + "'")
+		}
+	}
+
+	return out, nil
+}
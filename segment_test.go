@@ -0,0 +1,139 @@
+package transku
+
+import (
+	"reflect"
+	"testing"
+)
+
+// segTexts gives the text of every segment, as the Dictionary sees it.
+func segTexts(m masked) []string {
+	texts := []string{}
+	for _, seg := range m.segs {
+		texts = append(texts, seg.text)
+	}
+	return texts
+}
+
+// unchanged joins masked text with every segment restored as is.
+func unchanged(t *testing.T) func(segment) string {
+	return func(seg segment) string {
+		out, err := seg.restore(seg.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+}
+
+func TestMask(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		segs []string
+	}{
+		{"sentences", "Soft cotton shirt. Machine wash cold!", []string{"Soft cotton shirt", "Machine wash cold"}},
+		{"clauses", "Size: large | Colour: red", []string{"Size", "large", "Colour", "red"}},
+		{"dash", "Fits well - runs small", []string{"Fits well", "runs small"}},
+		{"hyphenated word", "Slim-fit shirt", []string{"Slim-fit shirt"}},
+		{"lines", "First line\r\nSecond line", []string{"First line", "Second line"}},
+		{"unicode", "Crème brûlée flavour. Größe passt", []string{"Crème brûlée flavour", "Größe passt"}},
+		{"percent", "100% cotton shirt", []string{"⟦n1⟧ cotton shirt"}},
+		{"units", "Fits 5 cm wide and holds 2 oz", []string{"Fits ⟦n1⟧ wide and holds ⟦n2⟧"}},
+		{"decimal", "Weighs 1.5 kg", []string{"Weighs ⟦n1⟧"}},
+		{"code", "MP3 player", []string{"⟦n1⟧ player"}},
+		{"parenthetical", "Pack of 3 (Large)", []string{"Pack of ⟦n1⟧ (Large)"}},
+		{"brand and symbol", "Acme flavor™ shirt", []string{"⟦b1⟧ flavor⟦n1⟧ shirt"}},
+		{"number only", "12345", []string{}},
+		{"punctuation only", " - . ", []string{}},
+		{"empty", "", []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := mask(tc.text, "Acme")
+			if got := segTexts(m); !reflect.DeepEqual(got, tc.segs) {
+				t.Fatalf("segments %q, want %q", got, tc.segs)
+			}
+			if len(m.lits) != len(m.segs)+1 {
+				t.Fatalf("%d literals around %d segments", len(m.lits), len(m.segs))
+			}
+			if back := m.join(unchanged(t)); back != tc.text {
+				t.Fatalf("joined '%s', want '%s'", back, tc.text)
+			}
+		})
+	}
+}
+
+func TestMaskJoinTranslated(t *testing.T) {
+	m := mask("Soft shirt, 2 pack. Machine wash cold.", "")
+	tlates := map[string]string{
+		"Soft shirt, ⟦n1⟧ pack": "⟦n1⟧er-Pack weiches Hemd",
+		"Machine wash cold":     "Kalt waschen",
+	}
+
+	out := m.join(func(seg segment) string {
+		tlate, err := seg.restore(tlates[seg.text])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tlate
+	})
+	if want := "2er-Pack weiches Hemd. Kalt waschen."; out != want {
+		t.Fatalf("joined '%s', want '%s'", out, want)
+	}
+}
+
+func TestHold(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		text  string
+		brand string
+		want  string
+		held  map[string]string
+	}{
+		{"brand inside phrase", "Shirt by Acme for men", "Acme", "Shirt by ⟦b1⟧ for men", map[string]string{"⟦b1⟧": "Acme"}},
+		{"brand twice", "Acme shirt, Acme hat", "Acme", "⟦b1⟧ shirt, ⟦b2⟧ hat", map[string]string{"⟦b1⟧": "Acme", "⟦b2⟧": "Acme"}},
+		{"brand and number", "Acme 2 pack", "Acme", "⟦b1⟧ ⟦n1⟧ pack", map[string]string{"⟦b1⟧": "Acme", "⟦n1⟧": "2"}},
+		{"no brand", "Acme 2 pack", "", "Acme ⟦n1⟧ pack", map[string]string{"⟦n1⟧": "2"}},
+		{"old markers", "Shirt {} [] <>", "", "Shirt {} [] ⟦n1⟧", map[string]string{"⟦n1⟧": "<>"}},
+		{"placeholder in source", "Has ⟦b1⟧ literal", "", "Has ⟦n1⟧⟦n2⟧⟦n3⟧ literal", map[string]string{"⟦n1⟧": "⟦", "⟦n2⟧": "b1", "⟦n3⟧": "⟧"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seg := hold(tc.text, tc.brand)
+			if seg.text != tc.want || !reflect.DeepEqual(seg.held, tc.held) {
+				t.Fatalf("held '%s' %q, want '%s' %q", seg.text, seg.held, tc.want, tc.held)
+			}
+			if back, err := seg.restore(seg.text); err != nil || back != tc.text {
+				t.Fatalf("restored '%s' (%v), want '%s'", back, err, tc.text)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	seg := hold("Shirt by Acme, 2 pack", "Acme")
+
+	for _, tc := range []struct {
+		name  string
+		tlate string
+		want  string
+		fails bool
+	}{
+		{"in order", "Hemd von ⟦b1⟧, ⟦n1⟧er-Pack", "Hemd von Acme, 2er-Pack", false},
+		{"reordered", "⟦n1⟧er-Pack ⟦b1⟧ Hemd", "2er-Pack Acme Hemd", false},
+		{"dropped", "⟦b1⟧ Hemd", "", true},
+		{"duplicated", "⟦n1⟧ ⟦n1⟧ ⟦b1⟧", "", true},
+		{"unknown", "⟦b1⟧ ⟦n1⟧ ⟦x1⟧", "", true},
+		{"mangled", "⟦b1⟧ ⟦ n1⟧", "", true},
+		{"half bracket", "⟦b1⟧ ⟦n1 Hemd", "", true},
+		{"empty", "", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := seg.restore(tc.tlate)
+			if (err != nil) != tc.fails {
+				t.Fatalf("error %v, want failure %v", err, tc.fails)
+			}
+			if got != tc.want {
+				t.Fatalf("restored '%s', want '%s'", got, tc.want)
+			}
+		})
+	}
+}
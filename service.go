@@ -0,0 +1,261 @@
+package transku
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/language"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// maxProductBody caps the size of a product payload.
+const maxProductBody = 1 << 20
+
+// saveEvery is how often dictionaries with newly translated phrases are written back to AWS.
+const saveEvery = 30 * time.Second
+
+var (
+	// errHeld is returned for products held back under HoldProduct.
+	errHeld = errors.New("product held for review")
+
+	// errTranslator is returned when the translator fails, which it reports by panicking.
+	errTranslator = errors.New("translator failed")
+)
+
+// translateService translates single products on demand.
+type translateService struct {
+	*regionDicts
+
+	// lock serializes the translator, whose destination is shared between regions.
+	// The dictionaries themselves are safe for concurrent use.
+	lock    sync.Mutex
+	parents parentSKUs
+	skus    map[string]chapi.Product
+
+	// dirty holds the regions with phrases not yet saved back to AWS.
+	dirtyLock sync.Mutex
+	dirty     map[string]Region
+}
+
+// errorBody is the response for products held for review or not translated.
+type errorBody struct {
+	Error   string   `json:"error"`
+	Phrases []string `json:"phrases,omitempty"`
+}
+
+// ServeTranslate serves on-demand translation of single products until it fails.
+//
+//	GET  /translate/{region}/{sku}  translates a product read from ChannelAdvisor
+//	POST /translate/{region}        translates a product posted as JSON
+//	GET  /metrics                   exposes run metrics
+//
+// Both give the product's PreCSV fields as JSON. Phrases missing from the Dictionary are
+// machine translated and saved back to AWS every saveEvery, so later requests are served from cache.
+func (t TransKU) ServeTranslate(addr string, regions []Region) error {
+	if t.rose == nil {
+		return errors.New("translation service needs gosetta initialized")
+	}
+
+	svc := &translateService{
+		regionDicts: newRegionDicts(t, regions),
+		parents:     newParentSKUs(t.prods, t.logger()),
+		skus:        map[string]chapi.Product{},
+		dirty:       map[string]Region{},
+	}
+	for _, prod := range t.prods {
+		svc.skus[prod.Sku] = prod
+	}
+	go func() {
+		for range time.Tick(saveEvery) {
+			svc.saveDirty()
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/translate/", svc.route)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		if allow(w, req, http.MethodGet) {
+			t.metrics.ServeHTTP(w, req)
+		}
+	})
+
+	t.logger().Info("serving translations", "addr", addr, "regions", len(regions), "products", len(t.prods))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
+
+// route serves '/translate/{region}/{sku}' and '/translate/{region}'.
+func (svc *translateService) route(w http.ResponseWriter, req *http.Request) {
+	parts := pathParts(req, "/translate/")
+	switch {
+	case len(parts[0]) == 0 || len(parts) > 2:
+		http.NotFound(w, req)
+	case len(parts) == 2:
+		if allow(w, req, http.MethodGet) {
+			svc.bySKU(w, parts[0], parts[1])
+		}
+	default:
+		if allow(w, req, http.MethodPost) {
+			svc.byPayload(w, req, parts[0])
+		}
+	}
+}
+
+func (svc *translateService) bySKU(w http.ResponseWriter, tag, sku string) {
+	prod, exists := svc.skus[sku]
+	if !exists {
+		http.Error(w, "unknown sku", http.StatusNotFound)
+		return
+	}
+	svc.respond(w, tag, prod)
+}
+
+func (svc *translateService) byPayload(w http.ResponseWriter, req *http.Request, tag string) {
+	prod := chapi.Product{}
+	err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxProductBody)).Decode(&prod)
+	if err != nil {
+		http.Error(w, "bad product: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	svc.respond(w, tag, prod)
+}
+
+func (svc *translateService) respond(w http.ResponseWriter, tag string, prod chapi.Product) {
+	pre, blocked, err := svc.translate(tag, prod)
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err == errHeld:
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(errorBody{err.Error(), blocked})
+		return
+	case err == errTranslator:
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(errorBody{Error: err.Error()})
+		return
+	case os.IsNotExist(err):
+		http.Error(w, "unknown region", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	json.NewEncoder(w).Encode(pre.json())
+}
+
+// translate runs a single product through a region's Dictionary, filling any misses first.
+func (svc *translateService) translate(tag string, prod chapi.Product) (PreCSV, []string, error) {
+	r, d, err := svc.get(tag)
+	if err != nil {
+		return PreCSV{}, nil, err
+	}
+	lang, err := language.Parse(r.BCP47)
+	if err != nil {
+		return PreCSV{}, nil, err
+	}
+	log := svc.t.regionLogger(r).With("sku", prod.Sku)
+
+	translate := func(s string) string {
+		svc.lock.Lock()
+		defer svc.lock.Unlock()
+
+		svc.t.rose.Destination(d.lang)
+		return svc.t.rose.MustTranslate(s)
+	}
+	d.lock.Lock()
+	d.translate = func(s string) string {
+		// GoTransAll translates from goroutines of its own, so a failure is left missing rather than recovered here
+		defer func() {
+			if p := recover(); p != nil {
+				log.Error("translator failed", "phrase", s, "panic", p)
+			}
+		}()
+		return translate(s)
+	}
+	d.lock.Unlock()
+
+	d.GoAdd([]chapi.Product{prod})
+	added, err := fill(d, prod, translate, log)
+	if added > 0 {
+		log.Info("translated new phrases", "phrases", added)
+		svc.markDirty(r)
+	}
+	if err != nil {
+		return PreCSV{}, nil, err
+	}
+
+	fresh := d.freshLen()
+	prods, res, err := d.GoTransAll([]chapi.Product{prod})
+	if d.freshLen() > fresh {
+		svc.markDirty(r)
+	}
+	if err != nil {
+		return PreCSV{}, nil, err
+	}
+	if len(prods) == 0 {
+		if blocked := res.Blocked[prod.Sku]; len(blocked) > 0 {
+			return PreCSV{}, blocked, errHeld
+		}
+		return PreCSV{}, nil, errors.New("product skipped for segments missing from Dictionary")
+	}
+
+	ip, err := newIntlProds(prods, svc.parents, r.ProfileID, r.label(), lang, r.attrPolicies(), newTracker(log, nil, strings.ToUpper(r.ChannelTag)))
+	if err != nil {
+		return PreCSV{}, nil, err
+	}
+
+	return ip.pres[0], nil, nil
+}
+
+// fill machine translates every phrase of prod still lacking a translation, giving how many it translated.
+// A translator panic is recovered as errTranslator, leaving the phrase untranslated.
+func fill(d *Dictionary, prod chapi.Product, translate func(string) string, log *slog.Logger) (added int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error("translator failed", "panic", p)
+			err = errTranslator
+		}
+	}()
+
+	for _, phrase := range d.productPhrases(prod) {
+		if e, _ := d.cache.get(phrase); len(e.tlate) == 0 {
+			d.translateOnce(phrase, translate)
+			added++
+		}
+	}
+	return added, nil
+}
+
+// markDirty queues a region's Dictionary to be saved back to AWS.
+func (svc *translateService) markDirty(r Region) {
+	svc.dirtyLock.Lock()
+	defer svc.dirtyLock.Unlock()
+
+	svc.dirty[strings.ToUpper(r.ChannelTag)] = r
+}
+
+// saveDirty writes every queued Dictionary back to AWS, queueing it again when that fails.
+func (svc *translateService) saveDirty() {
+	svc.dirtyLock.Lock()
+	dirty := svc.dirty
+	svc.dirty = map[string]Region{}
+	svc.dirtyLock.Unlock()
+
+	for tag, r := range dirty {
+		_, d, err := svc.get(tag)
+		if err == nil {
+			err = svc.t.SaveDict(r, d)
+		}
+		if err != nil {
+			svc.t.regionLogger(r).Error("saving Dictionary", "err", err)
+			svc.markDirty(r)
+		}
+	}
+}
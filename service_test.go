@@ -0,0 +1,34 @@
+package transku
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestFillRecoversTranslator(t *testing.T) {
+	d := newDictionary(language.German, DefaultAttrPolicies(), lookup{}, reviewBook{})
+	prod := loadProds(1)[0]
+	d.GoAdd(loadProds(1))
+
+	calls := 0
+	added, err := fill(d, prod, func(s string) string {
+		calls++
+		if calls > 1 {
+			panic("quota exceeded")
+		}
+		return "übersetzt " + s
+	}, logger)
+	if err != errTranslator {
+		t.Fatalf("error %v, want errTranslator", err)
+	}
+	if added != 1 {
+		t.Fatalf("%d phrases translated before the failure, want 1", added)
+	}
+
+	// the failed phrase is left untranslated and free to be tried again
+	added, err = fill(d, prod, func(s string) string { return "übersetzt " + s }, logger)
+	if err != nil || added != len(d.productPhrases(prod))-1 {
+		t.Fatalf("retry translated %d phrases: %v", added, err)
+	}
+}
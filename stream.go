@@ -0,0 +1,211 @@
+package transku
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+
+	"golang.org/x/text/language"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// familyBatches splits products into batches of about size, by index, keeping every variation family together.
+// A family bigger than size makes a batch of its own.
+func familyBatches(prods []chapi.Product, size int) [][]int {
+	families := [][]int{}
+	byParent := map[int]int{}
+	for i, prod := range prods {
+		id := familyID(prod)
+		if id == 0 {
+			families = append(families, []int{i})
+			continue
+		}
+		f, exists := byParent[id]
+		if !exists {
+			f = len(families)
+			byParent[id] = f
+			families = append(families, nil)
+		}
+		families[f] = append(families[f], i)
+	}
+
+	batches := [][]int{}
+	batch := []int{}
+	for _, fam := range families {
+		if len(batch) > 0 && len(batch)+len(fam) > size {
+			batches = append(batches, batch)
+			batch = []int{}
+		}
+		batch = append(batch, fam...)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// batchesHash fingerprints how products were split, so a resumed stream only skips batches cut the same way.
+func batchesHash(prods []chapi.Product, batches [][]int) string {
+	h := sha1.New()
+	for _, batch := range batches {
+		for _, i := range batch {
+			h.Write([]byte(prods[i].Sku))
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// streamDict translates, converts, serializes and uploads products a batch at a time,
+// so no more than a single batch is ever held translated, as PreCSV or as CSV rows.
+// The catalog itself is still held whole, as read from ChannelAdvisor, and so is the upload record under DeltaUpload.
+// Progress is noted after every batch, letting a failed run resume after the last batch sent.
+func (t TransKU) streamDict(dict *Dictionary, r Region, rep *Report) error {
+	log := t.regionLogger(r)
+	if t.resumable(r, StageUploaded) {
+		return nil
+	}
+
+	lang, err := language.Parse(r.BCP47)
+	if err != nil {
+		return err
+	}
+
+	var rec, next uploadRecord
+	if r.DeltaUpload {
+		if t.aws == nil {
+			return errors.New("delta uploads need awsapi initialized")
+		}
+		rec, next = t.readUploadRecord(r), uploadRecord{}
+	}
+
+	ps := newParentSKUs(t.prods, log)
+	batches := familyBatches(t.prods, r.Batch)
+	fresh := dict.freshLen()
+
+	fnm := t.runPath(r, "stream.json")
+	up := readProgress(fnm, batchesHash(t.prods, batches))
+	if up.Sent > 0 {
+		log.Info("resuming stream", "batch", up.Sent+1, "batches", len(batches))
+	}
+
+	prog := t.tracker(r).start("stream products", len(t.prods))
+	for i, batch := range batches {
+		sent := i < up.Sent
+		if sent && !r.DeltaUpload {
+			prog.add(len(batch))
+			continue
+		}
+
+		prods := make([]chapi.Product, len(batch))
+		for j, k := range batch {
+			prods[j] = t.prods[k]
+		}
+
+		// sent batches are still rebuilt under DeltaUpload, as the upload record needs every row
+		done := step(log.With("batch", i+1, "batches", len(batches)), "streaming batch")
+		ip, err := t.buildBatch(dict, r, lang, ps, prods, rep)
+		if err != nil {
+			prog.end(err)
+			return err
+		}
+		if r.DeltaUpload {
+			ip = rec.changed(ip, next)
+		}
+		if !sent {
+			err = t.sendBatch(ip)
+			if err != nil {
+				prog.end(err)
+				return err
+			}
+			up.Sent = i + 1
+			err = writeProgress(fnm, up)
+			if err != nil {
+				return err
+			}
+		}
+		done()
+		prog.add(len(batch))
+	}
+
+	if r.DeltaUpload {
+		gone := IntlProds{pres: rec.vanished(next, r.DeactivateLabel, t.catalogSKUs(r)), profileID: r.ProfileID, layout: r.AttrLayout, region: r}
+		if up.Sent <= len(batches) {
+			err = t.sendBatch(gone)
+			if err != nil {
+				return err
+			}
+			up.Sent = len(batches) + 1
+			err = writeProgress(fnm, up)
+			if err != nil {
+				return err
+			}
+		}
+		err = t.writeUploadRecord(r, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dict.freshLen() > fresh {
+		err = t.SaveDict(r, dict)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Remove(fnm)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if t.checkpointing() {
+		return writeMarker(t.stagePath(r, StageUploaded))
+	}
+
+	return nil
+}
+
+// buildBatch translates and converts a batch of products, noting whatever was held back or left out in the report.
+func (t TransKU) buildBatch(dict *Dictionary, r Region, lang language.Tag, ps parentSKUs, prods []chapi.Product, rep *Report) (IntlProds, error) {
+	newProds, res, err := dict.GoTransAll(prods)
+	rep.Missing = append(rep.Missing, res.Missing...)
+	for sku, phrases := range res.Blocked {
+		rep.Blocked[sku] = phrases
+	}
+	if err != nil {
+		return IntlProds{}, err
+	}
+	if r.Missing == SkipProduct {
+		rep.Skipped = append(rep.Skipped, res.Skipped...)
+	}
+
+	ip, err := newIntlProds(newProds, ps, r.ProfileID, r.label(), lang, r.attrPolicies(), t.tracker(r))
+	if err != nil {
+		t.metrics.Add(MetricValidationFailures, strings.ToUpper(r.ChannelTag), 1)
+		return ip, err
+	}
+	ip.layout = r.AttrLayout
+	ip.region = r
+
+	ip = t.checkFamilies(newProds, ip)
+	for _, fi := range ip.families.Issues {
+		rep.Warnings = append(rep.Warnings, fi.String())
+	}
+	rep.Skipped = append(rep.Skipped, ip.skipped...)
+
+	return ip, nil
+}
+
+// sendBatch serializes a batch and uploads it chunk by chunk, sending nothing for an empty batch.
+func (t TransKU) sendBatch(ip IntlProds) error {
+	if len(ip.pres) == 0 {
+		return nil
+	}
+	layout, profileID := ip.GetCSVLayout()
+	return t.sendChunks(layout, profileID, ip.region)
+}
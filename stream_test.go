@@ -0,0 +1,109 @@
+package transku
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/text/language"
+
+	"github.com/WedgeNix/chapi"
+)
+
+// familyProds builds a catalog of two families split up by standalone products:
+// P1 with C1 and C2, S1, P2 with C3, then S2.
+func familyProds() []chapi.Product {
+	return []chapi.Product{
+		{ID: 1, IsParent: true, Sku: "P1"},
+		{ID: 2, ParentProductID: 1, Sku: "C1"},
+		{ID: 10, Sku: "S1"},
+		{ID: 3, IsParent: true, Sku: "P2"},
+		{ID: 4, ParentProductID: 3, Sku: "C3"},
+		{ID: 5, ParentProductID: 1, Sku: "C2"},
+		{ID: 11, Sku: "S2"},
+	}
+}
+
+func TestFamilyBatches(t *testing.T) {
+	prods := familyProds()
+
+	for _, tc := range []struct {
+		name string
+		size int
+		want [][]string
+	}{
+		{"one each", 1, [][]string{{"P1", "C1", "C2"}, {"S1"}, {"P2", "C3"}, {"S2"}}},
+		{"pairs", 2, [][]string{{"P1", "C1", "C2"}, {"S1"}, {"P2", "C3"}, {"S2"}}},
+		{"fours", 4, [][]string{{"P1", "C1", "C2", "S1"}, {"P2", "C3", "S2"}}},
+		{"all", 100, [][]string{{"P1", "C1", "C2", "S1", "P2", "C3", "S2"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := [][]string{}
+			for _, batch := range familyBatches(prods, tc.size) {
+				skus := []string{}
+				for _, i := range batch {
+					skus = append(skus, prods[i].Sku)
+				}
+				got = append(got, skus)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("batches %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBatchesHash(t *testing.T) {
+	prods := familyProds()
+
+	same := batchesHash(prods, familyBatches(prods, 2))
+	if batchesHash(prods, familyBatches(prods, 2)) != same {
+		t.Fatal("same batches hashed differently")
+	}
+	if batchesHash(prods, familyBatches(prods, 4)) == same {
+		t.Fatal("batches cut differently hashed the same")
+	}
+	if batchesHash(prods[:6], familyBatches(prods[:6], 2)) == same {
+		t.Fatal("different products hashed the same")
+	}
+}
+
+// TestStreamResume resumes a stream after its first batch was sent, with nothing left to upload,
+// as every product is missing its only segment under SkipProduct.
+func TestStreamResume(t *testing.T) {
+	prods := []chapi.Product{
+		{ID: 1, Sku: "A", Attributes: []chapi.AttributeValue{{Name: "AMZColor", Value: "Red"}}},
+		{ID: 2, Sku: "B", Attributes: []chapi.AttributeValue{{Name: "AMZColor", Value: "Blue"}}},
+	}
+	r := Region{BCP47: "de", ChannelTag: "DE", Batch: 1, Missing: SkipProduct}
+	tk := TransKU{prods: prods, runDir: t.TempDir(), resume: true, metrics: newMetrics()}
+
+	fnm := tk.runPath(r, "stream.json")
+	err := writeProgress(fnm, uploadProgress{Hash: batchesHash(prods, familyBatches(prods, r.Batch)), Sent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := tk.newRegionDict(r, lookup{}, reviewBook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.lang = language.German
+
+	rep := &Report{Blocked: map[string][]string{}}
+	err = tk.streamDict(d, r, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the batch not yet sent is built again
+	if !reflect.DeepEqual(rep.Skipped, []string{"B"}) {
+		t.Fatalf("skipped %q, want only B", rep.Skipped)
+	}
+	if _, err := os.Stat(fnm); !os.IsNotExist(err) {
+		t.Fatalf("progress left behind: %v", err)
+	}
+	if !tk.resumable(r, StageUploaded) {
+		t.Fatal("stream not marked uploaded")
+	}
+}
@@ -2,13 +2,13 @@ package transku
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/WedgeNix/awsapi"
-	"github.com/WedgeNix/util"
 
 	"github.com/WedgeNix/chapi"
 	"github.com/WedgeNix/gosetta"
@@ -17,14 +17,16 @@ import (
 
 // InitChapi creates a new instance for translating English ChannelAdvisor data.
 func InitChapi(start time.Time) (*TransKU, error) {
-	util.Log("Initializing transKU" + "...")
+	run := time.Now().UTC().Format("20060102T150405Z")
+
+	done := step(logger.With("run", run), "initializing transKU")
 	ca, err := chapi.New()
 	if err != nil {
 		return nil, err
 	}
-	util.Log("Initializing transKU" + " !")
+	done()
 
-	return &TransKU{ca: ca, createDate: start}, nil
+	return &TransKU{ca: ca, createDate: start, run: run, metrics: newMetrics()}, nil
 }
 
 // InitAwsapi initializes Awsapi right before point needed.
@@ -51,48 +53,78 @@ func (t *TransKU) InitGosetta() error {
 
 // ReadChannelAdvisor reads ChannelAdvisor product information in for parsing.
 func (t *TransKU) ReadChannelAdvisor() error {
+	log := t.logger()
 	fnm := "prods.gob"
+	if t.checkpointing() {
+		fnm = t.stagePath(Region{}, StageFetched)
+	}
 
 	f, err := os.Open(fnm)
+	if err == nil && t.checkpointing() && !t.resume {
+		// a fresh run never reuses an older checkpoint
+		f.Close()
+		err = os.ErrNotExist
+	}
 	if err == nil {
-		util.Log("Decoding product data from '" + fnm + "'" + "...")
+		done := step(log.With("file", fnm), "decoding product data")
 		d := gob.NewDecoder(f)
 		err = d.Decode(&t.prods)
 		if err != nil {
 			return err
 		}
-		util.Log("Decoding product data from '" + fnm + "'" + " !")
+		done()
 	} else {
-		util.Log("Reading product data from ChannelAdvisor" + "...")
+		done := step(log, "reading product data from ChannelAdvisor")
 		prods, err := t.ca.GetCAData(t.createDate)
 		if err != nil {
 			return err
 		}
 		t.prods = prods
-		util.Log("Reading product data from ChannelAdvisor" + " !")
+		done()
 
 		f, err = os.Create(fnm)
 		if err != nil {
 			return err
 		}
 
-		util.Log("Encoding product data to '" + fnm + "'" + "...")
+		done = step(log.With("file", fnm), "encoding product data")
 		e := gob.NewEncoder(f)
 		err = e.Encode(prods)
 		if err != nil {
 			return err
 		}
-		util.Log("Encoding product data to '" + fnm + "'" + " !")
+		done()
 	}
 	f.Close()
+	log.Info("products read", "count", len(t.prods))
+	t.metrics.Add(MetricProductsRead, "", float64(len(t.prods)))
 
 	return nil
 }
 
 // CreateDict creates and translates a Dictionary.
 func (t TransKU) CreateDict(r Region) (*Dictionary, error) {
-	fnm := strings.ToLower(r.ChannelTag + ".gob")
-	dict := lookup{}
+	log := t.regionLogger(r)
+
+	if t.resumable(r, StageDictFilled) {
+		df := dictFile{}
+		err := readGob(t.stagePath(r, StageDictFilled), &df)
+		if err != nil {
+			return nil, err
+		}
+		d, err := t.newRegionDict(r, df.Cache, df.Reviews)
+		if err != nil {
+			return nil, err
+		}
+		if df.Fresh != nil {
+			d.loaded, d.cacheCharCnt, d.fresh = df.Loaded, df.LoadedChars, df.Fresh
+		}
+		if t.rose != nil {
+			t.rose.Destination(d.lang)
+			d.translate = t.rose.MustTranslate
+		}
+		return d, nil
+	}
 
 	// f, err := os.Open(fnm)
 	// if err == nil {
@@ -106,44 +138,39 @@ func (t TransKU) CreateDict(r Region) (*Dictionary, error) {
 	// 	util.Log("Decoding Dictionary from '" + fnm + "'" + " !")
 	// } else {
 
-	util.Log("Reading Dictionary from AWS" + "...")
-	err := t.aws.Read("transku/"+fnm, &dict)
+	d, err := t.LoadDict(r)
 	if err != nil {
 		return nil, err
 	}
-	util.Log("Reading Dictionary from AWS" + " !")
+	log.Info("Dictionary loaded", "entries", d.cache.len())
 	// }
 
 	// fmt.Println("[check your memory usage] aws.Read")
 	// time.Sleep(10 * time.Second)
 
-	util.Log("Initializing Dictionary" + "...")
-	tag, err := language.Parse(r.BCP47)
-	if err != nil {
-		return nil, err
-	}
-	d := newDictionary(tag, dict)
-	util.Log("Initializing Dictionary" + " !")
-
-	// fmt.Println("[check your memory usage] newDictionary")
-	// time.Sleep(10 * time.Second)
-
-	util.Log("Adding words/phrases to Dictionary" + "...")
+	done := step(log, "adding words/phrases to Dictionary")
 	d.GoAdd(t.prods)
-	util.Log("Adding words/phrases to Dictionary" + " !")
+	done()
+
+	// Dictionaries keyed by the phrases of older versions share few keys with today's segments
+	if added := d.cache.len() - d.loaded; d.loaded > 0 && added > d.loaded {
+		log.Warn("most catalog segments are missing from the Dictionary: entries keyed before sentence segmentation "+
+			"no longer match and are translated again, reviews included; 'transku-dict prune' drops the old entries",
+			"loaded", d.loaded, "new", added)
+	}
 
 	// fmt.Println("[check your memory usage] GoAdd")
 	// time.Sleep(10 * time.Second)
 
-	fmt.Println(d.GetPrice())
+	log.Info("translation price", "price", fmt.Sprint(d.GetPrice()), "entries", d.cache.len())
 
 	// fmt.Println("[check your memory usage] GetPrice")
 	// time.Sleep(10 * time.Second)
 
-	util.Log("Translating words in Dictionary" + "...")
-	t.rose.Destination(tag)
+	done = step(log, "translating words in Dictionary")
+	t.rose.Destination(d.lang)
 	d.GoFillAll(t.rose.MustTranslate)
-	util.Log("Translating words in Dictionary" + " !")
+	done()
 
 	// fmt.Println("[check your memory usage] GoFillAll")
 	// time.Sleep(10 * time.Second)
@@ -163,49 +190,187 @@ func (t TransKU) CreateDict(r Region) (*Dictionary, error) {
 	// fmt.Println("[check your memory usage] Encode dict")
 	// time.Sleep(10 * time.Second)
 
-	util.Log("Writing Dictionary to AWS" + "...")
-	err = t.aws.Write("transku/"+fnm, dict)
+	err = t.SaveDict(r, d)
 	if err != nil {
 		return nil, err
 	}
-	util.Log("Writing Dictionary to AWS" + " !")
 
 	// fmt.Println("[check your memory usage] Write aws")
 	// time.Sleep(240 * time.Second)
 
+	if t.checkpointing() {
+		err = t.writeDictFilled(r, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return d, nil
 }
 
+// writeDictFilled checkpoints a filled Dictionary along with what it held when read from AWS.
+func (t TransKU) writeDictFilled(r Region, d *Dictionary) error {
+	tlates, reviews := d.cache.snapshot()
+	return writeGob(t.stagePath(r, StageDictFilled), dictFile{
+		Cache:       tlates,
+		Reviews:     reviews,
+		Loaded:      d.loaded,
+		LoadedChars: d.cacheCharCnt,
+		Fresh:       d.newPhrases(),
+	})
+}
+
 // ApplyDict translates ChannelAdvisor data from English to another language.
 func (t TransKU) ApplyDict(dict *Dictionary, r Region) (IntlProds, error) {
-	util.Log("Translating products using Dictionary" + "...")
-	newProds := dict.GoTransAll(t.prods)
-	util.Log("Translating products using Dictionary" + " !")
+	log := t.regionLogger(r)
+
+	if t.resumable(r, StageBuilt) {
+		ip, err := loadJSON(t.stagePath(r, StageBuilt))
+		if err != nil {
+			return ip, err
+		}
+		ip.layout = r.AttrLayout
+		ip.region = r
+		ip.attrOrder = r.attrPolicies().exportNames()
+		return ip, nil
+	}
+
+	var newProds []chapi.Product
+	var res TransResult
+	if t.resumable(r, StageTranslated) {
+		err := readGob(t.stagePath(r, StageTranslated), &newProds)
+		if err != nil {
+			return IntlProds{}, err
+		}
+	} else {
+		done := step(log, "translating products using Dictionary")
+		fresh := dict.freshLen()
+		var err error
+		newProds, res, err = dict.GoTransAll(t.prods)
+		if err != nil {
+			return IntlProds{trans: res}, err
+		}
+		done()
+
+		if dict.freshLen() > fresh {
+			err = t.SaveDict(r, dict)
+			if err != nil {
+				return IntlProds{}, err
+			}
+		}
+
+		if t.checkpointing() {
+			err := writeGob(t.stagePath(r, StageTranslated), newProds)
+			if err != nil {
+				return IntlProds{}, err
+			}
+		}
+	}
 
 	caTag := strings.ToUpper(r.ChannelTag)
 
-	util.Log("Converting translated to international format [" + caTag + "]" + "...")
+	done := step(log, "converting translated to international format")
 	lang, err := language.Parse(r.BCP47)
 	if err != nil {
 		return IntlProds{}, err
 	}
-	ip, err := newIntlProds(newProds, r.ProfileID, `Amazon Seller Central - `+caTag, lang)
+	ip, err := newIntlProds(newProds, newParentSKUs(newProds, log), r.ProfileID, r.label(), lang, r.attrPolicies(), t.tracker(r))
 	if err != nil {
+		t.metrics.Add(MetricValidationFailures, caTag, 1)
 		return ip, err
 	}
-	util.Log("Converting translated to international format [" + caTag + "]" + " !")
+	ip.layout = r.AttrLayout
+	ip.region = r
+	ip.trans = res
+	done()
+
+	done = step(log, "checking variation families")
+	ip = t.checkFamilies(newProds, ip)
+	done()
+
+	if r.Missing == SkipProduct {
+		ip.skipped = append(ip.skipped, res.Skipped...)
+	}
+
+	if t.checkpointing() {
+		err = ip.saveJSON(t.stagePath(r, StageBuilt))
+		if err != nil {
+			return ip, err
+		}
+	}
 
 	return ip, nil
 }
 
+// checkFamilies reports the variation families of translated products, dropping broken ones when the region asks.
+func (t TransKU) checkFamilies(newProds []chapi.Product, ip IntlProds) IntlProds {
+	r := ip.region
+	log := t.regionLogger(r)
+
+	fr := CheckFamilies(newProds, ip)
+	t.metrics.Add(MetricValidationFailures, strings.ToUpper(r.ChannelTag), float64(len(fr.Issues)))
+	for _, fi := range fr.Issues {
+		log.Warn(string(fi.Problem), "parent", fi.ParentSKU, "skus", fi.SKUs, "detail", fi.Detail)
+	}
+	ip.families = fr
+	if !fr.OK() && r.DropBrokenFamilies {
+		kept := ip.Without(fr.BrokenSKUs())
+		kept.skipped = skippedSKUs(ip, kept)
+		ip = kept
+		log.Warn("dropped broken variation families", "skipped", len(ip.skipped))
+	}
+
+	return ip
+}
+
 // WriteChannelAdvisor writes to a ChannelAdvisor region database.
 func (t TransKU) WriteChannelAdvisor(ip IntlProds) error {
-	util.Log("Writing binary CSV to ChannelAdvisor" + "...")
-	err := t.ca.SendBinaryCSV(ip.GetCSVLayout())
+	r := ip.region
+	log := t.regionLogger(r)
+	if t.resumable(r, StageUploaded) {
+		return nil
+	}
+
+	var rec uploadRecord
+	if r.DeltaUpload {
+		if t.aws == nil {
+			return errors.New("delta uploads need awsapi initialized")
+		}
+		ip, rec = t.readUploadRecord(r).delta(ip, r.DeactivateLabel, t.catalogSKUs(r))
+		log.Info("delta upload", "rows", len(ip.pres))
+		if len(ip.pres) == 0 {
+			return nil
+		}
+	}
+
+	done := step(log, "writing binary CSV to ChannelAdvisor")
+	layout, profileID := ip.GetCSVLayout()
+	err := t.sendChunks(layout, profileID, r)
 	if err != nil {
 		return err
 	}
-	util.Log("Writing binary CSV to ChannelAdvisor" + " !")
+	done()
+
+	if r.DeltaUpload {
+		err = t.writeUploadRecord(r, rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	if t.checkpointing() {
+		return writeMarker(t.stagePath(r, StageUploaded))
+	}
 
 	return nil
 }
+
+// UploadFile sends a previously saved (possibly hand-edited) international products file to ChannelAdvisor.
+func (t TransKU) UploadFile(fnm string, r Region) error {
+	ip, err := LoadIntlProds(fnm, r.ProfileID)
+	if err != nil {
+		return err
+	}
+	ip.region = r
+	return t.WriteChannelAdvisor(ip)
+}
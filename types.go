@@ -16,6 +16,39 @@ type Region struct {
 	BCP47      string
 	ChannelTag string
 	ProfileID  int
+
+	// DropBrokenFamilies keeps broken variation families from being uploaded.
+	DropBrokenFamilies bool
+
+	// Attrs decides which attributes are exported and translated; nil uses FilterAttr.
+	Attrs *AttrPolicies
+
+	// AttrLayout decides how attributes are laid out as CSV columns.
+	AttrLayout AttrLayout
+
+	// DeltaUpload only sends rows that are new or changed since the last upload.
+	DeltaUpload bool
+
+	// DeactivateLabel, when set with DeltaUpload, re-sends SKUs gone from the catalog with only this label.
+	// Nothing is deactivated unless the whole catalog was read, without a createDate window.
+	DeactivateLabel string
+
+	// Chunking splits uploads into separately retried pieces; zero sends everything at once.
+	Chunking Chunking
+
+	// Quality decides which machine translations are quarantined; nil uses DefaultQualityCheck.
+	Quality *QualityCheck
+
+	// Review decides what happens to Dictionary entries that are not approved.
+	Review ReviewPolicy
+
+	// Missing decides what happens to segments missing from the Dictionary, or translated to nothing.
+	Missing MissingPolicy
+
+	// Batch streams products through translation, conversion and upload this many at a time,
+	// keeping variation families together; zero handles every product at once.
+	// It bounds the translated copies held at once, not the catalog, which is always read whole.
+	Batch int
 }
 
 // TransKU holds transKU controller data.
@@ -25,21 +58,33 @@ type TransKU struct {
 	prods      []chapi.Product
 	aws        *awsapi.Controller
 	rose       *gosetta.Rose
+	runDir     string
+	resume     bool
+	run        string
+	metrics    *Metrics
+	observer   Observer
 }
 
 // Dictionary holds the dictionary information.
+//
+// Every method is safe to call from many goroutines at once: entries live in a sharded cache,
+// while lock guards the phrases translated since loading and those being translated right now.
+// What a GoTransAll held back or found missing comes back from the call itself.
 type Dictionary struct {
-	jobs         sync.WaitGroup
 	lock         sync.RWMutex
-	cache        lookup
+	cache        *cache
 	cacheCharCnt int
 	lang         language.Tag
+	attrs        AttrPolicies
+	trk          tracker
+	metrics      *Metrics
+	loaded       int
+	fresh        lookup
+	quality      QualityCheck
+	policy       ReviewPolicy
+	missing      MissingPolicy
+	translate    func(string) string
+	inflight     map[string]chan struct{}
 }
 
 type lookup map[string]string
-
-type bag struct {
-	items []string
-	tok   string
-	tlate bool
-}